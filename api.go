@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tsvEscaper экранирует символы, которые ломают разбор TSV по строкам и столбцам.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// APIHandler возвращает результат извлечения изображений в машиночитаемом виде.
+// Формат задаётся параметром 'format': json (по умолчанию) или tsv.
+func APIHandler(w http.ResponseWriter, r *http.Request) {
+	inputURL := r.FormValue("url")
+
+	// Проверяем формат до начала загрузки, чтобы не сканировать страницу зря.
+	format := r.FormValue("format")
+	if format != "" && format != "json" && format != "tsv" {
+		http.Error(w, fmt.Sprintf("неизвестный формат %q", format), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseScrapeOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order, err := parseSortOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := fetchImages(inputURL, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	order.apply(result.Images)
+	setSummaryHeaders(w, result)
+
+	if format == "tsv" {
+		writeTSV(w, result.Images)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// writeJSON выводит результат сканирования в формате JSON: изображения, их общий размер
+// и список изображений, которые не удалось загрузить.
+func writeJSON(w http.ResponseWriter, result ScrapeResult) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeTSV выводит изображения построчно, разделяя поля табуляцией, с заголовком в первой строке.
+func writeTSV(w http.ResponseWriter, images []ImageData) {
+	w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+	fmt.Fprint(w, "url\twidth\theight\tsize\n")
+	for _, img := range images {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", tsvEscaper.Replace(img.URL), img.Width, img.Height, img.Size)
+	}
+}
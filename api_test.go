@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAPIHandlerTSV(t *testing.T) {
+	site := newSite(t, map[string]string{"/": `<html><body><img src="/a.png"><img src="/b.png"></body></html>`})
+
+	rec := httptest.NewRecorder()
+	APIHandler(rec, httptest.NewRequest("GET", "/api?format=tsv&url="+url.QueryEscape(site.URL+"/"), nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/tab-separated-values") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	size := len(pngBytes(10, 20))
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n") {
+		rows = append(rows, strings.Split(line, "\t"))
+	}
+	want := [][]string{
+		{"url", "width", "height", "size"},
+		{site.URL + "/a.png", "10", "20", strconv.Itoa(size)},
+		{site.URL + "/b.png", "10", "20", strconv.Itoa(size)},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestWriteTSVEscaping(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeTSV(rec, []ImageData{{URL: "http://x/a\tb\nc\\d.png", Width: 1, Height: 2, Size: 3}})
+
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want header and one row: %q", len(lines), rec.Body.String())
+	}
+	fields := strings.Split(lines[1], "\t")
+	if want := []string{`http://x/a\tb\nc\\d.png`, "1", "2", "3"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %q, want %q", fields, want)
+	}
+}
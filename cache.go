@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cacheTTL — время жизни закэшированного результата сканирования (флаг -cache-ttl).
+// 0 отключает кэш.
+var cacheTTL = 5 * time.Minute
+
+// cacheEntry — результат сканирования и момент, после которого он считается устаревшим.
+type cacheEntry struct {
+	result  ScrapeResult
+	expires time.Time
+}
+
+// resultCache хранит результаты сканирования в памяти. Устаревшие записи удаляются
+// лениво — при обращении к кэшу.
+type resultCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// pageCache — общий кэш результатов для всех обработчиков.
+var pageCache = &resultCache{entries: make(map[string]cacheEntry)}
+
+// cacheKey строит ключ кэша из URL страницы и параметров, влияющих на результат.
+func cacheKey(pageURL string, opts scrapeOptions) string {
+	return fmt.Sprintf("%s\x00%d\x00%s", pageURL, opts.Depth, opts.Referer)
+}
+
+// get возвращает копию ещё не устаревшего результата по ключу.
+func (c *resultCache) get(key string) (ScrapeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return ScrapeResult{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return ScrapeResult{}, false
+	}
+	return entry.result.clone(), true
+}
+
+// set сохраняет копию результата и попутно удаляет устаревшие записи.
+func (c *resultCache) set(key string, result ScrapeResult) {
+	if cacheTTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{result: result.clone(), expires: now.Add(cacheTTL)}
+}
+
+// clone копирует срезы результата, чтобы сортировка у вызывающей стороны не меняла кэш.
+func (r ScrapeResult) clone() ScrapeResult {
+	r.Images = append([]ImageData(nil), r.Images...)
+	r.Failed = append([]FailedImage(nil), r.Failed...)
+	r.Warnings = append([]Warning(nil), r.Warnings...)
+	return r
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// deviceUserAgents сопоставляет тип устройства с характерной строкой User-Agent.
+// Некоторые сайты отдают мобильным и настольным браузерам разные изображения.
+var deviceUserAgents = map[string]string{
+	"desktop": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+	"mobile":  "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+}
+
+// device задаёт устройство, от имени которого выполняются запросы (флаг -device).
+var device = "desktop"
+
+// userAgent, если задан (флаг -user-agent), заменяет User-Agent выбранного устройства.
+var userAgent string
+
+// newRequest создаёт GET-запрос с User-Agent выбранного устройства (или userAgent)
+// и дополнительными заголовками header, которые могут быть nil.
+func newRequest(rawURL string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	ua := userAgent
+	if ua == "" {
+		var ok bool
+		if ua, ok = deviceUserAgents[device]; !ok {
+			return nil, fmt.Errorf("неизвестное устройство %q", device)
+		}
+	}
+	req.Header.Set("User-Agent", ua)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	// Явно запрашиваем сжатие: в этом случае транспорт не распаковывает ответ сам,
+	// и распаковка выполняется в decodeBody для gzip и deflate одинаково.
+	// Вызывающая сторона может переопределить заголовок (например, для докачки).
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	return req, nil
+}
+
+// doGet выполняет GET-запрос с дополнительными заголовками header и возвращает ответ
+// с уже распакованным телом. Вызывающая сторона должна закрыть тело ответа.
+func doGet(rawURL string, header http.Header) (*http.Response, error) {
+	req, err := newRequest(rawURL, header)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// Считаем байты до распаковки, чтобы знать фактический объём, переданный по сети.
+	resp.Body = &countingBody{ReadCloser: resp.Body}
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decodeBody заменяет тело ответа распаковывающим читателем согласно заголовку Content-Encoding.
+// После распаковки заголовки сжатия удаляются, как это делает стандартный транспорт.
+func decodeBody(resp *http.Response) error {
+	var decoded io.ReadCloser
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("некорректный gzip в ответе %s: %w", resp.Request.URL, err)
+		}
+		decoded = gz
+	case "deflate":
+		// По стандарту deflate передаётся в обёртке zlib, но часть серверов шлёт «сырой» поток.
+		br := bufio.NewReader(resp.Body)
+		if isZlibHeader(br) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return fmt.Errorf("некорректный deflate в ответе %s: %w", resp.Request.URL, err)
+			}
+			decoded = zr
+		} else {
+			decoded = flate.NewReader(br)
+		}
+	default:
+		return fmt.Errorf("неподдерживаемое сжатие %q в ответе %s", resp.Header.Get("Content-Encoding"), resp.Request.URL)
+	}
+
+	resp.Body = &decodedBody{ReadCloser: decoded, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// isZlibHeader проверяет, начинается ли поток с корректного заголовка zlib (RFC 1950).
+func isZlibHeader(br *bufio.Reader) bool {
+	hdr, err := br.Peek(2)
+	if err != nil {
+		return false
+	}
+	return hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0
+}
+
+// decodedBody закрывает и распаковщик, и исходное тело ответа.
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.raw.Close()
+}
+
+// TransferSize возвращает число сжатых байтов, прочитанных из исходного тела.
+func (b *decodedBody) TransferSize() int64 {
+	return transferSize(b.raw)
+}
+
+// countingBody считает байты, прочитанные из тела ответа в том виде, в каком они пришли по сети.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// TransferSize возвращает число прочитанных байтов.
+func (b *countingBody) TransferSize() int64 {
+	return b.n
+}
+
+// transferSize возвращает объём, переданный по сети для тела ответа body, созданного doGet.
+// Для других читателей возвращает 0.
+func transferSize(body io.Reader) int64 {
+	if tc, ok := body.(interface{ TransferSize() int64 }); ok {
+		return tc.TransferSize()
+	}
+	return 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestDeviceUserAgent(t *testing.T) {
+	// Сервер отдаёт мобильным браузерам другой набор изображений (Vary: User-Agent).
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.Write(pngBytes(1, 1))
+			return
+		}
+		w.Header().Set("Vary", "User-Agent")
+		if strings.Contains(r.UserAgent(), "Mobile") {
+			io.WriteString(w, `<html><body><img src="/m1.png"><img src="/m2.png"></body></html>`)
+			return
+		}
+		io.WriteString(w, `<html><body><img src="/desktop.png"></body></html>`)
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		device string
+		want   []string
+	}{
+		{"desktop", []string{srv.URL + "/desktop.png"}},
+		{"mobile", []string{srv.URL + "/m1.png", srv.URL + "/m2.png"}},
+	} {
+		setVar(t, &device, tt.device)
+		result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := imageURLs(result.Images); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("device=%s: got %v, want %v", tt.device, got, tt.want)
+		}
+	}
+}
+
+// compress сжимает данные указанным методом: gzip, deflate (в обёртке zlib) или raw-deflate.
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&b, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = fw
+	}
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestCompressedPage(t *testing.T) {
+	const page = `<html><body><img src="/a.png"><img src="/b.png"></body></html>`
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				w.Write(pngBytes(10, 20))
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				t.Errorf("Accept-Encoding = %q", r.Header.Get("Accept-Encoding"))
+			}
+			// Сырой поток deflate без zlib-обёртки тоже передаётся как "deflate".
+			w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+			w.Header().Set("Content-Type", "text/html")
+			w.Write(compress(t, encoding, []byte(page)))
+		}))
+
+		result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if want := []string{srv.URL + "/a.png", srv.URL + "/b.png"}; !reflect.DeepEqual(imageURLs(result.Images), want) {
+			t.Errorf("%s: got %v, want %v", encoding, imageURLs(result.Images), want)
+		}
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	setVar(t, &userAgent, "TestAgent/1.0")
+
+	var mu sync.Mutex
+	agents := make(map[string]string)
+	referers := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.URL.Path] = r.UserAgent()
+		referers[r.URL.Path] = r.Referer()
+		mu.Unlock()
+		if r.URL.Path == "/page" {
+			io.WriteString(w, `<html><body><img src="/a.png"></body></html>`)
+			return
+		}
+		w.Write(pngBytes(1, 1))
+	}))
+	defer srv.Close()
+	pageURL := srv.URL + "/page"
+
+	// По умолчанию Referer изображения — адрес страницы.
+	if _, err := fetchImages(pageURL, scrapeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/page", "/a.png"} {
+		if agents[path] != "TestAgent/1.0" {
+			t.Errorf("%s: User-Agent = %q, want TestAgent/1.0", path, agents[path])
+		}
+	}
+	if referers["/page"] != "" {
+		t.Errorf("page request sent Referer %q", referers["/page"])
+	}
+	if referers["/a.png"] != pageURL {
+		t.Errorf("image Referer = %q, want %q", referers["/a.png"], pageURL)
+	}
+
+	// Явно переданный referer заменяет адрес страницы.
+	if _, err := fetchImages(pageURL, scrapeOptions{Referer: "https://cdn.example.com/", NoCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if referers["/a.png"] != "https://cdn.example.com/" {
+		t.Errorf("image Referer = %q, want the referer option", referers["/a.png"])
+	}
+}
+
+func TestTransferSize(t *testing.T) {
+	// Несжатый BMP хорошо сжимается gzip.
+	var raw bytes.Buffer
+	if err := bmp.Encode(&raw, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	compressed := compress(t, "gzip", raw.Bytes())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><body><img src="/big.bmp"><img src="/plain.png"></body></html>`)
+		case "/big.bmp":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed)
+		default:
+			w.Write(pngBytes(10, 20))
+		}
+	}))
+	defer srv.Close()
+
+	result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Images) != 2 {
+		t.Fatalf("got %d images (failed: %v), want 2", len(result.Images), result.Failed)
+	}
+
+	big, plain := result.Images[0], result.Images[1]
+	if big.Size != int64(raw.Len()) || big.TransferSize != int64(len(compressed)) || big.TransferSize >= big.Size {
+		t.Errorf("gzip image: Size=%d TransferSize=%d, want %d and %d", big.Size, big.TransferSize, raw.Len(), len(compressed))
+	}
+	if big.Width != 64 || big.Height != 64 {
+		t.Errorf("gzip image decoded as %d×%d", big.Width, big.Height)
+	}
+	if plain.TransferSize != plain.Size {
+		t.Errorf("uncompressed image: Size=%d TransferSize=%d", plain.Size, plain.TransferSize)
+	}
+	if want := big.TransferSize + plain.TransferSize; result.TotalTransferSize != want {
+		t.Errorf("TotalTransferSize = %d, want %d", result.TotalTransferSize, want)
+	}
+}
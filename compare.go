@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/html"
+)
+
+// sharedImage — изображение, найденное на обеих страницах, с разницей размеров (B минус A).
+type sharedImage struct {
+	A, B      ImageData
+	SizeDelta int64
+}
+
+// imageDiff — сравнение изображений двух страниц по URL.
+type imageDiff struct {
+	OnlyA  []ImageData
+	OnlyB  []ImageData
+	Shared []sharedImage
+}
+
+// diffImages раскладывает изображения двух результатов на уникальные для каждой страницы
+// и общие. Порядок сохраняется: OnlyA и Shared — как на странице A, OnlyB — как на B.
+// Повторы одного URL на странице учитываются один раз.
+func diffImages(a, b ScrapeResult) imageDiff {
+	inB := make(map[string]ImageData, len(b.Images))
+	for _, img := range b.Images {
+		if _, ok := inB[img.URL]; !ok {
+			inB[img.URL] = img
+		}
+	}
+
+	var diff imageDiff
+	inA := make(map[string]bool, len(a.Images))
+	for _, img := range a.Images {
+		if inA[img.URL] {
+			continue
+		}
+		inA[img.URL] = true
+		if other, ok := inB[img.URL]; ok {
+			diff.Shared = append(diff.Shared, sharedImage{A: img, B: other, SizeDelta: other.Size - img.Size})
+		} else {
+			diff.OnlyA = append(diff.OnlyA, img)
+		}
+	}
+	seenB := make(map[string]bool, len(b.Images))
+	for _, img := range b.Images {
+		if inA[img.URL] || seenB[img.URL] {
+			continue
+		}
+		seenB[img.URL] = true
+		diff.OnlyB = append(diff.OnlyB, img)
+	}
+	return diff
+}
+
+// CompareHandler сканирует две страницы (параметры 'a' и 'b') и показывает рядом изображения,
+// которые есть только на одной из них, и общие изображения с разницей в размере.
+// Остальные параметры сканирования (depth, referer, nocache) применяются к обеим страницам.
+func CompareHandler(w http.ResponseWriter, r *http.Request) {
+	urlA, urlB := r.FormValue("a"), r.FormValue("b")
+	if urlA == "" || urlB == "" {
+		http.Error(w, "нужно указать обе страницы: параметры a и b", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseScrapeOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resultA, err := fetchImages(urlA, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("страница A: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resultB, err := fetchImages(urlB, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("страница B: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	renderCompare(w, urlA, urlB, diffImages(resultA, resultB))
+}
+
+// formatSizeDelta форматирует разницу размеров со знаком.
+func formatSizeDelta(delta int64) string {
+	switch {
+	case delta > 0:
+		return "+" + formatSize(delta)
+	case delta < 0:
+		return "−" + formatSize(-delta)
+	default:
+		return "без изменений"
+	}
+}
+
+// renderCompare выводит три колонки: только на A, общие и только на B.
+func renderCompare(w http.ResponseWriter, urlA, urlB string, diff imageDiff) {
+	fmt.Fprintf(w, `<html>
+ <head>
+  <title>Image Scraper Compare</title>
+ </head>
+ <body>
+  <div>
+   <h3>A: %s</h3>
+   <h3>B: %s</h3>
+  </div>
+  <div style="display: flex;">`, html.EscapeString(urlA), html.EscapeString(urlB))
+
+	fmt.Fprintf(w, `
+   <div style="width: 33%%; padding: 5px;">
+    <h3>Только на A: %d</h3>`, len(diff.OnlyA))
+	for _, img := range diff.OnlyA {
+		renderCompareImage(w, img.URL, fmt.Sprintf("%d×%d, %s", img.Width, img.Height, formatSize(img.Size)))
+	}
+	fmt.Fprintf(w, `
+   </div>
+   <div style="width: 33%%; padding: 5px;">
+    <h3>Общие: %d</h3>`, len(diff.Shared))
+	for _, s := range diff.Shared {
+		renderCompareImage(w, s.A.URL, fmt.Sprintf("A: %s, B: %s (%s)", formatSize(s.A.Size), formatSize(s.B.Size), formatSizeDelta(s.SizeDelta)))
+	}
+	fmt.Fprintf(w, `
+   </div>
+   <div style="width: 33%%; padding: 5px;">
+    <h3>Только на B: %d</h3>`, len(diff.OnlyB))
+	for _, img := range diff.OnlyB {
+		renderCompareImage(w, img.URL, fmt.Sprintf("%d×%d, %s", img.Width, img.Height, formatSize(img.Size)))
+	}
+	fmt.Fprintf(w, `
+   </div>
+  </div>
+ </body>
+ </html>`)
+}
+
+// renderCompareImage выводит миниатюру изображения с подписью.
+func renderCompareImage(w http.ResponseWriter, imgURL, caption string) {
+	fmt.Fprintf(w, `
+    <div style="padding: 5px;">
+     <img src="%s" style="max-width: 100%%;">
+     <div>%s</div>
+    </div>`, html.EscapeString(imgURL), html.EscapeString(caption))
+}
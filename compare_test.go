@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffImages(t *testing.T) {
+	a := ScrapeResult{Images: []ImageData{
+		{URL: "http://x/logo.png", Size: 100},
+		{URL: "http://x/old.png", Size: 10},
+		{URL: "http://x/hero.jpg", Size: 500},
+		{URL: "http://x/logo.png", Size: 100},
+	}}
+	b := ScrapeResult{Images: []ImageData{
+		{URL: "http://x/hero.jpg", Size: 300},
+		{URL: "http://x/new.png", Size: 20},
+		{URL: "http://x/logo.png", Size: 150},
+		{URL: "http://x/new.png", Size: 20},
+	}}
+
+	diff := diffImages(a, b)
+	if got, want := imageURLs(diff.OnlyA), []string{"http://x/old.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OnlyA = %v, want %v", got, want)
+	}
+	if got, want := imageURLs(diff.OnlyB), []string{"http://x/new.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OnlyB = %v, want %v", got, want)
+	}
+
+	type shared struct {
+		url   string
+		delta int64
+	}
+	var got []shared
+	for _, s := range diff.Shared {
+		if s.A.URL != s.B.URL {
+			t.Errorf("shared pair %s / %s", s.A.URL, s.B.URL)
+		}
+		got = append(got, shared{s.A.URL, s.SizeDelta})
+	}
+	// Общие изображения идут в порядке страницы A, разница — B минус A.
+	if want := []shared{{"http://x/logo.png", 50}, {"http://x/hero.jpg", -200}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Shared = %v, want %v", got, want)
+	}
+}
+
+func TestCompareHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			io.WriteString(w, `<html><body><img src="/shared.png"><img src="/only-a.png"></body></html>`)
+		case "/b":
+			io.WriteString(w, `<html><body><img src="/only-b.png"><img src="/shared.png"></body></html>`)
+		default:
+			w.Write(pngBytes(4, 4))
+		}
+	}))
+	defer srv.Close()
+
+	rec := httptest.NewRecorder()
+	target := "/compare?a=" + url.QueryEscape(srv.URL+"/a") + "&b=" + url.QueryEscape(srv.URL+"/b")
+	CompareHandler(rec, httptest.NewRequest("GET", target, nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Колонки идут в порядке: только на A, общие, только на B.
+	body := rec.Body.String()
+	columns := strings.Split(body, `<div style="width: 33%;`)[1:]
+	if len(columns) != 3 {
+		t.Fatalf("got %d columns, want 3", len(columns))
+	}
+	want := []struct{ heading, img string }{
+		{"Только на A: 1", "/only-a.png"},
+		{"Общие: 1", "/shared.png"},
+		{"Только на B: 1", "/only-b.png"},
+	}
+	for i, col := range columns {
+		if !strings.Contains(col, want[i].heading) || strings.Count(col, "<img ") != 1 || !strings.Contains(col, srv.URL+want[i].img) {
+			t.Errorf("column %d = %s, want %q with only %s", i, col, want[i].heading, want[i].img)
+		}
+	}
+	if !strings.Contains(body, "без изменений") {
+		t.Error("shared image has no size delta")
+	}
+
+	rec = httptest.NewRecorder()
+	CompareHandler(rec, httptest.NewRequest("GET", "/compare?a="+url.QueryEscape(srv.URL+"/a"), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing b: status %d, want 400", rec.Code)
+	}
+}
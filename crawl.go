@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// maxFollowedPages ограничивает общее число дополнительных страниц, просматриваемых при обходе.
+const maxFollowedPages = 20
+
+// maxDepth — максимальная глубина обхода ссылок, которую можно запросить (флаг -max-depth).
+var maxDepth = 3
+
+// parseDepth читает параметр 'depth': 0 (по умолчанию) — только указанная страница,
+// N — переходить по ссылкам не дальше N уровней.
+func parseDepth(r *http.Request) (int, error) {
+	v := r.FormValue("depth")
+	if v == "" {
+		return 0, nil
+	}
+	depth, err := strconv.Atoi(v)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("некорректное значение depth %q", v)
+	}
+	if depth > maxDepth {
+		return 0, fmt.Errorf("глубина обхода не может превышать %d", maxDepth)
+	}
+	return depth, nil
+}
+
+// discovery — результат поиска изображений на странице и, при обходе, на связанных страницах.
+type discovery struct {
+	URLs      []string       // URL изображений в порядке обнаружения
+	RefCounts map[string]int // Число страниц, ссылающихся на каждое изображение
+	Warnings  []Warning      // Предупреждения, собранные при разборе страниц
+}
+
+// uniqueURLs убирает повторы, сохраняя порядок первого появления: изображение, которое
+// встречается на странице несколько раз или на нескольких страницах, загружается один раз.
+func uniqueURLs(urls []string) []string {
+	seen := make(map[string]bool, len(urls))
+	var unique []string
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			unique = append(unique, u)
+		}
+	}
+	return unique
+}
+
+// addPageRefs учитывает ссылки одной страницы: каждое изображение засчитывается странице
+// один раз, сколько бы раз оно на ней ни встречалось.
+func addPageRefs(refs map[string]int, urls []string) {
+	onPage := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		if !onPage[u] {
+			onPage[u] = true
+			refs[u]++
+		}
+	}
+}
+
+// crawledPage — результат загрузки и разбора одной страницы при обходе.
+type crawledPage struct {
+	urls     []string
+	warnings []Warning
+	links    []string
+	ok       bool
+}
+
+// crawlLinkedPages обходит в ширину страницы того же источника (схема и хост),
+// на которые ссылается doc, не глубже depth уровней, и объединяет найденные на них
+// изображения с disc. Страницы одного уровня загружаются параллельно (не более fetchWorkers
+// одновременно), а объединяются в порядке ссылок, поэтому результат детерминирован.
+// Каждая страница загружается не более одного раза, а в RefCounts считается, на скольких
+// страницах встретилось каждое изображение. Повторы в disc.URLs не убираются (см. uniqueURLs).
+// Недоступные страницы пропускаются.
+func crawlLinkedPages(doc *html.Node, pageURL string, disc discovery, depth int) discovery {
+	visited := make(map[string]bool)
+	if base, err := url.Parse(pageURL); err == nil {
+		// Разрешаем адрес относительно самого себя, как ссылки в extractLinks (убираются "." и "..").
+		visited[normalizePageURL(base.ResolveReference(base))] = true
+	}
+	followed := 0
+	level := extractLinks(doc, pageURL)
+	for d := 1; d <= depth && len(level) > 0; d++ {
+		// Выбираем ещё не посещённые страницы уровня в пределах общего лимита.
+		var batch []string
+		for _, link := range level {
+			if followed >= maxFollowedPages {
+				break
+			}
+			if visited[link] {
+				continue
+			}
+			visited[link] = true
+			followed++
+			batch = append(batch, link)
+		}
+
+		pages := crawlPages(batch, d < depth)
+
+		var next []string
+		for _, page := range pages {
+			if !page.ok {
+				continue
+			}
+			addPageRefs(disc.RefCounts, page.urls)
+			disc.URLs = append(disc.URLs, page.urls...)
+			disc.Warnings = append(disc.Warnings, page.warnings...)
+			next = append(next, page.links...)
+		}
+		level = next
+	}
+	return disc
+}
+
+// crawlPages параллельно загружает и разбирает страницы links. Результаты возвращаются
+// в том же порядке, что и links. Ссылки со страниц собираются, только если withLinks равен true:
+// со страниц последнего уровня они уже не понадобятся.
+func crawlPages(links []string, withLinks bool) []crawledPage {
+	pages := make([]crawledPage, len(links))
+	sem := make(chan struct{}, fetchWorkers)
+	var wg sync.WaitGroup
+	for i, link := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, link string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			subDoc, err := fetchPage(link, true)
+			if err != nil {
+				return
+			}
+			urls, warnings, err := extractImageURLs(subDoc, link)
+			if err != nil {
+				return
+			}
+			page := crawledPage{urls: urls, warnings: warnings, ok: true}
+			if withLinks {
+				page.links = extractLinks(subDoc, link)
+			}
+			pages[i] = page
+		}(i, link)
+	}
+	wg.Wait()
+	return pages
+}
+
+// extractLinks собирает ссылки <a href> на страницы того же источника (схема и хост), что и baseURL.
+// Ссылки приводятся к виду normalizePageURL, чтобы одна страница не загружалась несколько раз.
+func extractLinks(n *html.Node, baseURL string) []string {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	var crawler func(*html.Node)
+	crawler = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == "a" {
+			for _, attr := range node.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				link, ok := resolveURL(base, attr.Val)
+				if !ok {
+					continue
+				}
+				u, err := url.Parse(link)
+				if err != nil || u.Scheme != base.Scheme || !strings.EqualFold(u.Host, base.Host) {
+					continue
+				}
+				links = append(links, normalizePageURL(u))
+			}
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			crawler(c)
+		}
+	}
+	crawler(n)
+	return links
+}
+
+// normalizePageURL приводит адрес страницы к единому виду для учёта посещённых страниц:
+// без фрагмента (#...) и с путём "/" вместо пустого, так что "http://host" и ссылка "/"
+// считаются одной страницей.
+func normalizePageURL(u *url.URL) string {
+	n := *u
+	n.Fragment = ""
+	n.RawFragment = ""
+	if n.Path == "" && n.Opaque == "" {
+		n.Path = "/"
+	}
+	return n.String()
+}
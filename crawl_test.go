@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCrawlDepth(t *testing.T) {
+	// Ссылка на другой источник не должна загружаться.
+	var foreignHits int32
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&foreignHits, 1)
+	}))
+	defer foreign.Close()
+
+	site := newSite(t, map[string]string{
+		"/":      `<html><body><img src="/home.png"><a href="/child">child</a><a href="` + foreign.URL + `/">other</a></body></html>`,
+		"/child": `<html><body><img src="/child.png"><a href="/">home</a></body></html>`,
+	})
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{site.URL + "/home.png"}},
+		{1, []string{site.URL + "/home.png", site.URL + "/child.png"}},
+	}
+	for _, tt := range tests {
+		result, err := fetchImages(site.URL+"/", scrapeOptions{Depth: tt.depth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := imageURLs(result.Images); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("depth=%d: got %v, want %v", tt.depth, got, tt.want)
+		}
+	}
+	if n := atomic.LoadInt32(&foreignHits); n != 0 {
+		t.Errorf("foreign origin was requested %d times", n)
+	}
+}
+
+func TestSharedImageFetchedOnce(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><body><img src="/shared.png"><img src="/home.png"><img src="shared.png"><a href="/">home</a><a href="/other">other</a></body></html>`)
+		case "/other":
+			// Ссылка назад на главную страницу, которая уже просмотрена.
+			io.WriteString(w, `<html><body><img src="/shared.png"><a href="/">home</a></body></html>`)
+		default:
+			mu.Lock()
+			hits[r.URL.Path]++
+			mu.Unlock()
+			w.Write(pngBytes(1, 1))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		page  string
+		depth int
+		refs  map[string]int
+	}{
+		// Повтор на одной странице засчитывается ей один раз.
+		{"/", 0, map[string]int{"/shared.png": 1, "/home.png": 1}},
+		{"/", 1, map[string]int{"/shared.png": 2, "/home.png": 1}},
+		// Адрес без пути и ссылка "/" на другой странице ведут на одну и ту же страницу.
+		{"", 1, map[string]int{"/shared.png": 2, "/home.png": 1}},
+		{"/#top", 1, map[string]int{"/shared.png": 2, "/home.png": 1}},
+	}
+	for _, tt := range tests {
+		hits = make(map[string]int)
+		result, err := fetchImages(srv.URL+tt.page, scrapeOptions{Depth: tt.depth})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refs := make(map[string]int)
+		for _, img := range result.Images {
+			path := strings.TrimPrefix(img.URL, srv.URL)
+			if _, dup := refs[path]; dup {
+				t.Errorf("%q depth=%d: %s reported twice", tt.page, tt.depth, path)
+			}
+			refs[path] = img.RefCount
+		}
+		if !reflect.DeepEqual(refs, tt.refs) {
+			t.Errorf("%q depth=%d: ref counts = %v, want %v", tt.page, tt.depth, refs, tt.refs)
+		}
+		if want := map[string]int{"/shared.png": 1, "/home.png": 1}; !reflect.DeepEqual(hits, want) {
+			t.Errorf("%q depth=%d: requests = %v, want each image once", tt.page, tt.depth, hits)
+		}
+	}
+}
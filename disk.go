@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// saveDir — каталог, в который сохраняются найденные изображения (флаг -save-dir).
+// Пустая строка отключает сохранение на диск.
+var saveDir string
+
+// manifestName — имя файла с описанием сохранённых изображений в каталоге -save-dir.
+const manifestName = "manifest.json"
+
+// diskMu защищает manifest.json и savingFiles от параллельных сканирований.
+var diskMu sync.Mutex
+
+// savingFiles — файлы (полные пути), которые сейчас записывают идущие сканирования,
+// и URL изображений, которые в них сохраняются.
+var savingFiles = make(map[string]string)
+
+// manifestEntry описывает сохранённый файл: исходный URL, размеры и объём.
+type manifestEntry struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+}
+
+// dirSave — сохранение изображений одного сканирования в каталог по ходу их загрузки.
+type dirSave struct {
+	dir   string
+	names map[string]string // Имена файлов по URL, зарезервированные этим сканированием
+
+	mu    sync.Mutex
+	saved map[string]bool // URL изображений, успешно сохранённых этим сканированием
+}
+
+// beginSave выбирает имена файлов для изображений imageURLs в каталоге dir и резервирует их
+// до вызова finish. Изображение, уже описанное в manifest.json, сохраняется в тот же файл;
+// новым изображениям достаются имена из URL (с номером при совпадении), не занятые
+// ни manifest.json, ни файлами в каталоге. Изображения, которые сейчас сохраняет
+// другое сканирование, этим сканированием на диск не записываются.
+func beginSave(dir string, imageURLs []string) (*dirSave, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Если один URL описан несколькими записями, выбираем имя детерминированно.
+	byURL := make(map[string]string, len(manifest))
+	for name, entry := range manifest {
+		if prev, ok := byURL[entry.URL]; !ok || name < prev {
+			byURL[entry.URL] = name
+		}
+	}
+
+	s := &dirSave{dir: dir, names: make(map[string]string), saved: make(map[string]bool)}
+	counts := make(map[string]int)
+	for _, imgURL := range imageURLs {
+		if _, ok := s.names[imgURL]; ok {
+			continue
+		}
+		part := partPath(dir, imgURL)
+		if _, busy := savingFiles[part]; busy {
+			continue
+		}
+		name, ok := byURL[imgURL]
+		if !ok {
+			name = freeName(dir, imgURL, counts, manifest)
+		}
+		dest := filepath.Join(dir, name)
+		if _, busy := savingFiles[dest]; busy {
+			continue
+		}
+		savingFiles[dest] = imgURL
+		savingFiles[part] = imgURL
+		s.names[imgURL] = name
+	}
+	return s, nil
+}
+
+// freeName подбирает для нового изображения имя, не занятое manifest.json, файлами
+// в каталоге dir и другими сканированиями. counts — счётчик имён текущего сканирования.
+// Вызывается с захваченным diskMu.
+func freeName(dir, imgURL string, counts map[string]int, manifest map[string]manifestEntry) string {
+	for {
+		name := zipEntryName(imgURL, counts)
+		if _, used := manifest[name]; used {
+			continue
+		}
+		if _, busy := savingFiles[filepath.Join(dir, name)]; busy {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			continue
+		}
+		return name
+	}
+}
+
+// download загружает изображение для сканирования и, если для него зарезервирован файл,
+// одновременно сохраняет его на диск (см. downloadFile).
+func (s *dirSave) download(imgURL string, header http.Header) ([]byte, int64, error) {
+	name, ok := s.names[imgURL]
+	if !ok {
+		return downloadImage(imgURL, header)
+	}
+	dest := filepath.Join(s.dir, name)
+	if !insideDir(s.dir, dest) {
+		return nil, 0, fmt.Errorf("имя файла %q выходит за пределы каталога %s", name, s.dir)
+	}
+	data, transferSize, err := downloadFile(imgURL, dest, header)
+	if err == nil {
+		s.mu.Lock()
+		s.saved[imgURL] = true
+		s.mu.Unlock()
+	}
+	return data, transferSize, err
+}
+
+// insideDir сообщает, находится ли путь path внутри каталога dir (но не совпадает с ним).
+// Имена файлов уже очищены imageName; это последняя проверка перед записью на диск.
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// finish снимает резервирование файлов и дописывает в manifest.json изображения images,
+// которые это сканирование действительно сохранило.
+func (s *dirSave) finish(images []ImageData) error {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	for imgURL, name := range s.names {
+		delete(savingFiles, filepath.Join(s.dir, name))
+		delete(savingFiles, partPath(s.dir, imgURL))
+	}
+
+	entries := make(map[string]manifestEntry)
+	for _, img := range images {
+		if s.saved[img.URL] {
+			entries[s.names[img.URL]] = manifestEntry{URL: img.URL, Width: img.Width, Height: img.Height, Size: img.Size}
+		}
+	}
+	return writeManifest(s.dir, entries)
+}
+
+// readManifest читает manifest.json из каталога dir. Отсутствующий файл — пустой манифест.
+func readManifest(dir string) (map[string]manifestEntry, error) {
+	path := filepath.Join(dir, manifestName)
+	manifest := make(map[string]manifestEntry)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("повреждён %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// writeManifest дополняет manifest.json в каталоге dir записями entries: описания файлов,
+// сохранённых при прошлых сканированиях, остаются, а запись с тем же именем обновляется,
+// только если она описывает тот же URL. Имя, занятое другим URL, не перезаписывается
+// (иначе манифест описывал бы не то изображение, что лежит в файле): остальные записи
+// сохраняются, а конфликт возвращается ошибкой.
+// Файл заменяется атомарно, чтобы прерванная запись не испортила его.
+// Вызывается с захваченным diskMu.
+func writeManifest(dir string, entries map[string]manifestEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	var conflict error
+	for name, entry := range entries {
+		if prev, ok := manifest[name]; ok && prev.URL != entry.URL {
+			conflict = fmt.Errorf("%s: имя %s уже занято изображением %s", manifestName, name, prev.URL)
+			continue
+		}
+		manifest[name] = entry
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, manifestName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return conflict
+}
+
+// partPath возвращает путь файла незавершённой загрузки изображения imgURL в каталоге dir.
+// Имя строится по хэшу URL, поэтому докачка продолжает только загрузку того же изображения,
+// под каким бы именем оно ни сохранялось.
+func partPath(dir, imgURL string) string {
+	sum := sha256.Sum256([]byte(imgURL))
+	return filepath.Join(dir, "."+hex.EncodeToString(sum[:8])+".part")
+}
+
+// downloadFile скачивает изображение в файл dest и возвращает его содержимое и число байтов,
+// переданных по сети. Данные сначала пишутся во временный файл (см. partPath); если такой
+// файл остался от прерванной загрузки, запрашивается только недостающая часть
+// (Range: bytes=N-). Если сервер не поддерживает диапазоны и отвечает 200, файл скачивается заново.
+func downloadFile(imgURL, dest string, header http.Header) ([]byte, int64, error) {
+	// Встроенное изображение записываем сразу, без сети.
+	if isDataImageURL(imgURL) {
+		data, err := decodeDataURL(imgURL)
+		if err != nil {
+			return nil, 0, err
+		}
+		return data, 0, os.WriteFile(dest, data, 0o644)
+	}
+
+	if err := validateURL(imgURL); err != nil {
+		return nil, 0, err
+	}
+
+	part := partPath(filepath.Dir(dest), imgURL)
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	// Диапазоны относятся к байтам в том виде, в каком их отдаёт сервер, поэтому
+	// для докачки отключаем сжатие ответа.
+	reqHeader := header.Clone()
+	if reqHeader == nil {
+		reqHeader = http.Header{}
+	}
+	reqHeader.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		reqHeader.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := doGet(imgURL, reqHeader)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && contentRangeStart(resp) == offset:
+		// Сервер прислал продолжение — дописываем его в конец.
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// Сервер проигнорировал Range — начинаем заново.
+		flags |= os.O_TRUNC
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Частичный файл не соответствует ресурсу (например, он изменился) — удаляем и качаем заново.
+		resp.Body.Close()
+		if err := os.Remove(part); err != nil {
+			return nil, 0, err
+		}
+		return downloadFile(imgURL, dest, header)
+	default:
+		return nil, 0, fmt.Errorf("%s: статус ответа %s", imgURL, resp.Status)
+	}
+
+	f, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		// Оставляем частичный файл на месте, чтобы в следующий раз продолжить с этого места.
+		f.Close()
+		return nil, 0, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, 0, err
+	}
+	data, err := os.ReadFile(part)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, transferSize(resp.Body), os.Rename(part, dest)
+}
+
+// contentRangeStart возвращает начальную позицию из заголовка Content-Range ("bytes 100-199/200")
+// или -1, если заголовок отсутствует или некорректен.
+func contentRangeStart(resp *http.Response) int64 {
+	v := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	start, _, ok := strings.Cut(v, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
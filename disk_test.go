@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestSaveDirResumesWithRange(t *testing.T) {
+	dir := t.TempDir()
+	setVar(t, &saveDir, dir)
+
+	full := pngBytes(40, 30)
+	const offset = 50
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			io.WriteString(w, `<html><body><img src="/photo.png"></body></html>`)
+			return
+		}
+		gotRange = r.Header.Get("Range")
+		if gotRange != "bytes="+strconv.Itoa(offset)+"-" {
+			w.Write(full)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(full)-1, len(full)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(full[offset:])
+	}))
+	defer srv.Close()
+	imgURL := srv.URL + "/photo.png"
+
+	// Остаток прерванной загрузки.
+	part := partPath(dir, imgURL)
+	if err := os.WriteFile(part, full[:offset], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bytes=" + strconv.Itoa(offset) + "-"; gotRange != want {
+		t.Errorf("Range = %q, want %q", gotRange, want)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "photo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, full) {
+		t.Errorf("saved file has %d bytes, want the full %d-byte image", len(saved), len(full))
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Errorf("partial file still exists: %v", err)
+	}
+
+	// Сканирование видит целое изображение, а по сети передан только остаток.
+	if len(result.Images) != 1 {
+		t.Fatalf("got %d images (failed: %v), want 1", len(result.Images), result.Failed)
+	}
+	img := result.Images[0]
+	if img.Width != 40 || img.Height != 30 || img.Size != int64(len(full)) || img.TransferSize != int64(len(full)-offset) {
+		t.Errorf("got %+v, want 40×30, size %d, transfer %d", img, len(full), len(full)-offset)
+	}
+}
+
+func TestSaveDirSameNameFromDifferentPages(t *testing.T) {
+	dir := t.TempDir()
+	setVar(t, &saveDir, dir)
+
+	// Два сайта с одинаковым именем файла, но разным содержимым.
+	var hits int
+	logoA, logoB := pngBytes(1, 1), pngBytes(2, 2)
+	newLogoSite := func(logo []byte) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				io.WriteString(w, `<html><body><img src="/logo.png"></body></html>`)
+				return
+			}
+			hits++
+			w.Write(logo)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	siteA, siteB := newLogoSite(logoA), newLogoSite(logoB)
+
+	for _, site := range []*httptest.Server{siteA, siteB, siteA} {
+		if _, err := fetchImages(site.URL+"/", scrapeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Каждое сканирование загружает изображение ровно один раз.
+	if hits != 3 {
+		t.Errorf("images were requested %d times, want 3", hits)
+	}
+
+	files := map[string][]byte{"logo.png": logoA, "logo_1.png": logoB}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s does not hold the expected image", name)
+		}
+	}
+	// Повторное сканирование первой страницы перезаписало её же файл, а не создало новый.
+	if _, err := os.Stat(filepath.Join(dir, "logo_2.png")); !os.IsNotExist(err) {
+		t.Errorf("unexpected logo_2.png: %v", err)
+	}
+}
+
+func TestSaveDirManifest(t *testing.T) {
+	dir := t.TempDir()
+	setVar(t, &saveDir, dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><body><img src="/a/photo.png"><img src="/b/photo.png"><img src="/missing.png"></body></html>`)
+		case "/a/photo.png":
+			w.Write(pngBytes(10, 20))
+		case "/b/photo.png":
+			w.Write(pngBytes(30, 40))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := fetchImages(srv.URL+"/", scrapeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest map[string]manifestEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	// Недоступное изображение в манифест не попадает.
+	want := map[string]manifestEntry{
+		"photo.png":   {URL: srv.URL + "/a/photo.png", Width: 10, Height: 20, Size: int64(len(pngBytes(10, 20)))},
+		"photo_1.png": {URL: srv.URL + "/b/photo.png", Width: 30, Height: 40, Size: int64(len(pngBytes(30, 40)))},
+	}
+	if !reflect.DeepEqual(manifest, want) {
+		t.Errorf("manifest = %+v, want %+v", manifest, want)
+	}
+	for name, entry := range manifest {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != entry.Size {
+			t.Errorf("%s has %d bytes, manifest says %d", name, info.Size(), entry.Size)
+		}
+	}
+}
+
+func TestWriteManifestKeepsOtherURL(t *testing.T) {
+	dir := t.TempDir()
+	first := map[string]manifestEntry{"logo.png": {URL: "http://a/logo.png", Size: 1}}
+	if err := writeManifest(dir, first); err != nil {
+		t.Fatal(err)
+	}
+	// Тот же URL обновляет запись, другой URL под тем же именем отклоняется.
+	if err := writeManifest(dir, map[string]manifestEntry{"logo.png": {URL: "http://a/logo.png", Size: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(dir, map[string]manifestEntry{"logo.png": {URL: "http://b/logo.png", Size: 3}}); err == nil {
+		t.Error("entry for another URL overwrote logo.png")
+	}
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest["logo.png"]; got.URL != "http://a/logo.png" || got.Size != 2 {
+		t.Errorf("logo.png = %+v", got)
+	}
+}
+
+func TestSaveDirHostileDataURI(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b", "c")
+	setVar(t, &saveDir, dir)
+
+	site := newSite(t, map[string]string{"/": `<html><body>
+<img src="data:image/../../../../pwned;base64,UFdORUQ=">
+<img src="/x/%2e%2e">
+</body></html>`})
+	if _, err := fetchImages(site.URL+"/", scrapeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Все файлы, включая manifest.json, должны оказаться внутри каталога сохранения.
+	var saved []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if !insideDir(dir, path) {
+			t.Errorf("file written outside -save-dir: %s", path)
+		}
+		saved = append(saved, filepath.Base(path))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(saved)
+	if want := []string{"image", "image_1", manifestName}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved files = %v, want %v", saved, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "image")); err != nil || string(data) != "PWNED" {
+		t.Errorf("image = %q, %v; want the data URI payload", data, err)
+	}
+}
+
+func TestInsideDir(t *testing.T) {
+	dir := filepath.Join("save", "dir")
+	tests := []struct {
+		path   string
+		inside bool
+	}{
+		{filepath.Join(dir, "a.png"), true},
+		{filepath.Join(dir, "sub", "a.png"), true},
+		{filepath.Join(dir, "..a.png"), true},
+		{dir, false},
+		{filepath.Join(dir, ".."), false},
+		{filepath.Join(dir, "..", "..", "pwned"), false},
+		{filepath.Join("save", "dirx", "a.png"), false},
+	}
+	for _, tt := range tests {
+		if got := insideDir(dir, tt.path); got != tt.inside {
+			t.Errorf("insideDir(%q, %q) = %v, want %v", dir, tt.path, got, tt.inside)
+		}
+	}
+}
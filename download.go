@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DownloadHandler находит изображения на странице и отдаёт их одним ZIP-архивом.
+// Изображения, которые не удалось загрузить, пропускаются.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	inputURL := r.FormValue("url")
+
+	opts, err := parseScrapeOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Находим изображения до отправки заголовков, чтобы при ошибке вернуть нормальный ответ.
+	disc, err := discoverImageURLs(inputURL, opts.Depth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="images.zip"`)
+
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	// Счётчик использованных имён для устранения коллизий.
+	names := make(map[string]int)
+	header := opts.imageHeader(inputURL)
+	for _, imgURL := range disc.URLs {
+		// Клиент отключился — продолжать загрузку бессмысленно.
+		if r.Context().Err() != nil {
+			return
+		}
+		// Неудачные изображения пропускаем, не прерывая весь архив.
+		writeZipEntry(zw, imgURL, header, names)
+	}
+}
+
+// writeZipEntry загружает изображение (или декодирует встроенный data URI) и добавляет его
+// в архив отдельной записью. Тело читается целиком до создания записи: если загрузка
+// оборвётся на середине, в архиве не останется усечённого файла. Так в памяти держится
+// не больше одного изображения, а архив по-прежнему передаётся клиенту по мере загрузки.
+func writeZipEntry(zw *zip.Writer, imgURL string, header http.Header, names map[string]int) error {
+	data, _, err := downloadImage(imgURL, header)
+	if err != nil {
+		return err
+	}
+
+	f, err := zw.Create(zipEntryName(imgURL, names))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// imageName возвращает имя файла изображения — последний сегмент пути URL.
+// У встроенных data URI пути нет, поэтому имя строится по их MIME-типу.
+// Имя используется для записей архива и файлов на диске, поэтому небезопасные имена
+// (см. isSafeFileName) заменяются на "image".
+func imageName(imgURL string) string {
+	if isDataImageURL(imgURL) {
+		if ext := imageExtension(imgURL); ext != "" {
+			return "image." + ext
+		}
+		return "image"
+	}
+	if u, err := url.Parse(imgURL); err == nil {
+		if name := path.Base(u.Path); isSafeFileName(name) {
+			return name
+		}
+	}
+	return "image"
+}
+
+// isSafeFileName сообщает, можно ли использовать имя из URL как имя файла внутри каталога
+// или архива: оно не пустое, не содержит разделителей каталогов и нулевых байтов
+// и не начинается с точки — это исключает ".", ".." и скрытые служебные файлы.
+// Путь URL хранится раскодированным, поэтому "%2e%2e" здесь уже выглядит как "..".
+func isSafeFileName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// zipEntryName получает имя файла из пути URL и добавляет к нему номер,
+// если такое имя уже встречалось в архиве.
+func zipEntryName(imgURL string, names map[string]int) string {
+	name := imageName(imgURL)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for names[candidate] > 0 {
+		candidate = fmt.Sprintf("%s_%d%s", stem, names[name], ext)
+		names[name]++
+	}
+	names[candidate]++
+	return candidate
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDownloadHandlerZip(t *testing.T) {
+	inline := pngBytes(2, 2)
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(inline)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><body>
+<img src="/a.png"><img src="/x/a.png"><img src="/missing.png"><img src="/truncated.png">
+<img src="`+dataURI+`">
+</body></html>`)
+		case "/missing.png":
+			http.NotFound(w, r)
+		case "/truncated.png":
+			// Обещаем больше байтов, чем отправляем: загрузка оборвётся на середине.
+			w.Header().Set("Content-Length", strconv.Itoa(1000))
+			w.Write([]byte("partial"))
+		default:
+			w.Write(pngBytes(10, 20))
+		}
+	}))
+	defer srv.Close()
+
+	rec := httptest.NewRecorder()
+	DownloadHandler(rec, httptest.NewRequest("GET", "/download?url="+url.QueryEscape(srv.URL+"/"), nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string][]byte)
+	var names []string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		entries[f.Name] = data
+		names = append(names, f.Name)
+	}
+
+	// Недоступное и оборванное изображения пропущены, встроенное — добавлено.
+	sort.Strings(names)
+	if want := []string{"a.png", "a_1.png", "image.png"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("entries = %v, want %v", names, want)
+	}
+	if !bytes.Equal(entries["image.png"], inline) {
+		t.Error("data URI entry does not match the inline image")
+	}
+	if !bytes.Equal(entries["a.png"], pngBytes(10, 20)) {
+		t.Error("a.png entry does not match the served image")
+	}
+}
+
+func TestImageNameIsSafe(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://x/a/photo.png", "photo.png"},
+		{"data:image/svg+xml,<svg/>", "image.svg"},
+		{"data:image/png;base64,AAAA", "image.png"},
+		// Враждебные имена заменяются на "image".
+		{"data:image/../../../../pwned;base64,UFdORUQ=", "image"},
+		{`data:image/a\b;base64,AAAA`, "image"},
+		{"http://x/y/%2e%2e", "image"},
+		{"http://x/y/%2e", "image"},
+		{"http://x/y/..%2fetc%2fpasswd", "passwd"},
+		{`http://x/y/..%5cwin.ini`, "image"},
+		{"http://x/.hidden.part", "image"},
+		{"http://x/", "image"},
+	}
+	for _, tt := range tests {
+		if got := imageName(tt.url); got != tt.want {
+			t.Errorf("imageName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadHandlerHostileNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			io.WriteString(w, `<html><body>
+<img src="data:image/../../../../pwned;base64,UFdORUQ=">
+<img src="/x/%2e%2e"><img src="/x/%2e"><img src="/x/..%2f..%2fevil.png"><img src="/x/.env">
+</body></html>`)
+			return
+		}
+		w.Write(pngBytes(1, 1))
+	}))
+	defer srv.Close()
+
+	rec := httptest.NewRecorder()
+	DownloadHandler(rec, httptest.NewRequest("GET", "/download?url="+url.QueryEscape(srv.URL+"/"), nil))
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 5 {
+		t.Errorf("got %d entries, want 5", len(zr.File))
+	}
+	for _, f := range zr.File {
+		if strings.ContainsAny(f.Name, `/\`) || f.Name == "." || f.Name == ".." || strings.HasPrefix(f.Name, ".") {
+			t.Errorf("unsafe entry name %q", f.Name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// onlyExtensions, если не пуст, оставляет только изображения с перечисленными расширениями
+// (флаг -only-extensions, например "png,svg"). Ключи хранятся в нормализованном виде.
+var onlyExtensions map[string]bool
+
+// extensionRe описывает допустимое расширение файла.
+var extensionRe = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// parseExtensions разбирает список расширений через запятую, допускаются точки и любой регистр.
+func parseExtensions(list string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		if ext = normalizeExtension(ext); ext != "" {
+			exts[ext] = true
+		}
+	}
+	return exts
+}
+
+// normalizeExtension приводит расширение к единому виду: без точки, в нижнем регистре,
+// с объединением синонимов (jpeg → jpg, tif → tiff).
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+	switch ext {
+	case "jpeg", "jpe":
+		return "jpg"
+	case "tif":
+		return "tiff"
+	}
+	return ext
+}
+
+// imageExtension возвращает нормализованное расширение изображения: для data URI —
+// по MIME-типу (image/svg+xml → svg), для остальных — по пути URL. Расширение может попасть
+// в имя файла, поэтому допускаются только латинские буквы и цифры; иначе возвращается "".
+func imageExtension(imgURL string) string {
+	var ext string
+	if isDataImageURL(imgURL) {
+		mime := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(imgURL)), "data:image/")
+		if i := strings.IndexAny(mime, ";,"); i >= 0 {
+			mime = mime[:i]
+		}
+		mime, _, _ = strings.Cut(mime, "+")
+		ext = normalizeExtension(mime)
+	} else if u, err := url.Parse(imgURL); err == nil {
+		ext = normalizeExtension(path.Ext(u.Path))
+	}
+	if !extensionRe.MatchString(ext) {
+		return ""
+	}
+	return ext
+}
+
+// filterExtensions оставляет только изображения с расширениями из onlyExtensions.
+func filterExtensions(imageURLs []string) []string {
+	if len(onlyExtensions) == 0 {
+		return imageURLs
+	}
+	var filtered []string
+	for _, imgURL := range imageURLs {
+		if onlyExtensions[imageExtension(imgURL)] {
+			filtered = append(filtered, imgURL)
+		}
+	}
+	return filtered
+}
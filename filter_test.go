@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOnlyExtensions(t *testing.T) {
+	setVar(t, &onlyExtensions, parseExtensions("png"))
+
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<html><body>
+<img src="/a.png"><img src="/b.jpg"><img src="/c.PNG?v=2"><img src="/d.gif"><img src="/e.svg"><img src="/f">
+</body></html>`))
+			return
+		}
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		w.Write(pngBytes(1, 1))
+	}))
+	defer srv.Close()
+
+	result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{srv.URL + "/a.png", srv.URL + "/c.PNG?v=2"}; !reflect.DeepEqual(imageURLs(result.Images), want) {
+		t.Errorf("got %v, want %v", imageURLs(result.Images), want)
+	}
+	for _, path := range requested {
+		if !strings.HasSuffix(strings.ToLower(path), ".png") {
+			t.Errorf("non-PNG image %s was requested", path)
+		}
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	got := parseExtensions(" .PNG, jpeg,tif,, svg ")
+	want := map[string]bool{"png": true, "jpg": true, "tiff": true, "svg": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
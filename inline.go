@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// isDataImageURL сообщает, является ли ссылка встроенным изображением data:image/...
+func isDataImageURL(s string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), "data:image/")
+}
+
+// decodeDataURL возвращает содержимое data URI: base64 или percent-кодированное.
+func decodeDataURL(dataURL string) ([]byte, error) {
+	meta, payload, ok := strings.Cut(strings.TrimSpace(dataURL), ",")
+	if !ok || !strings.HasPrefix(strings.ToLower(meta), "data:") {
+		return nil, errors.New("некорректный data URI")
+	}
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		// Внутри атрибутов base64 нередко переносят на несколько строк.
+		payload = strings.Join(strings.Fields(payload), "")
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			// Часть генераторов опускает выравнивание '='.
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		}
+		return data, err
+	}
+	s, err := url.PathUnescape(payload)
+	return []byte(s), err
+}
+
+// isSVG определяет SVG по data URI, расширению в пути URL или по содержимому.
+func isSVG(imgURL string, data []byte) bool {
+	if strings.HasPrefix(strings.ToLower(imgURL), "data:image/svg+xml") {
+		return true
+	}
+	if u, err := url.Parse(imgURL); err == nil && strings.EqualFold(path.Ext(u.Path), ".svg") {
+		return true
+	}
+	head := bytes.TrimSpace(data)
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return (bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<svg"))) &&
+		bytes.Contains(head, []byte("<svg"))
+}
+
+// svgSize читает ширину и высоту из корневого элемента <svg>: атрибуты width/height
+// в пикселях или, если их нет, размеры из viewBox. Относительные размеры (проценты, em)
+// не определить без отрисовки, поэтому для них возвращаются нули.
+func svgSize(data []byte) (int, int) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if el.Name.Local != "svg" {
+			return 0, 0
+		}
+
+		var width, height, viewBox string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = attr.Value
+			case "height":
+				height = attr.Value
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
+		w, wok := svgLength(width)
+		h, hok := svgLength(height)
+		if wok && hok {
+			return w, h
+		}
+		if f := strings.Fields(strings.ReplaceAll(viewBox, ",", " ")); len(f) == 4 {
+			vw, err1 := strconv.ParseFloat(f[2], 64)
+			vh, err2 := strconv.ParseFloat(f[3], 64)
+			if err1 == nil && err2 == nil {
+				return int(vw + 0.5), int(vh + 0.5)
+			}
+		}
+		return 0, 0
+	}
+}
+
+// svgLength разбирает длину SVG без единиц измерения или в пикселях.
+func svgLength(s string) (int, bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "px")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return int(v + 0.5), true
+}
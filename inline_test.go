@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDataURIImage(t *testing.T) {
+	data := pngBytes(3, 4)
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+	site := newSite(t, map[string]string{"/": `<html><body><img src="` + dataURI + `"></body></html>`})
+
+	result, err := fetchImages(site.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Images) != 1 {
+		t.Fatalf("got %d images (failed: %v), want 1", len(result.Images), result.Failed)
+	}
+	img := result.Images[0]
+	if img.URL != dataURI || img.Width != 3 || img.Height != 4 || img.Size != int64(len(data)) || img.TransferSize != 0 {
+		t.Errorf("got %+v, want 3×4, size %d, no transfer", img, len(data))
+	}
+}
+
+func TestSVGImage(t *testing.T) {
+	const svg = `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="120" height="40"><rect/></svg>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			io.WriteString(w, `<html><body><img src="/logo.svg"><img src="`+
+				"data:image/svg+xml,"+url.PathEscape(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 9"/>`)+`"></body></html>`)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		io.WriteString(w, svg)
+	}))
+	defer srv.Close()
+
+	result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Images) != 2 {
+		t.Fatalf("got %d images (failed: %v), want 2", len(result.Images), result.Failed)
+	}
+	if img := result.Images[0]; img.Width != 120 || img.Height != 40 || img.Size != int64(len(svg)) {
+		t.Errorf("logo.svg = %+v, want 120×40, size %d", img, len(svg))
+	}
+	if img := result.Images[1]; img.Width != 16 || img.Height != 9 {
+		t.Errorf("inline SVG = %+v, want 16×9", img)
+	}
+}
+
+func TestSVGSize(t *testing.T) {
+	tests := []struct {
+		svg           string
+		width, height int
+	}{
+		{`<svg width="100" height="50"/>`, 100, 50},
+		{`<svg width="100px" height="50.4px"/>`, 100, 50},
+		// viewBox используется, если ширина или высота не заданы в пикселях.
+		{`<svg viewBox="0 0 300 150"/>`, 300, 150},
+		{`<svg width="100%" height="100%" viewBox="0,0,64,32"/>`, 64, 32},
+		{`<svg width="10em" height="5em"/>`, 0, 0},
+		{`<?xml version="1.0"?><!-- logo --><svg width="8" height="8"/>`, 8, 8},
+		{`<html/>`, 0, 0},
+		{`not xml`, 0, 0},
+	}
+	for _, tt := range tests {
+		if w, h := svgSize([]byte(tt.svg)); w != tt.width || h != tt.height {
+			t.Errorf("svgSize(%s) = %d×%d, want %d×%d", tt.svg, w, h, tt.width, tt.height)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+// minQuality — порог оценки качества JPEG (флаг -min-quality). Изображения с оценкой ниже
+// порога помечаются как вероятно пережатые. 0 — проверка выключена.
+var minQuality int
+
+// stdLuminanceTable — стандартная таблица квантования яркости из приложения K стандарта JPEG,
+// которую libjpeg масштабирует в зависимости от качества.
+var stdLuminanceTable = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// estimateJPEGQuality оценивает качество (1–100), с которым был сохранён JPEG, по таблице
+// квантования яркости из маркера DQT. Оценка подбирает качество, при котором формула
+// масштабирования libjpeg даёт ту же таблицу, и точна для файлов, сохранённых
+// со стандартными таблицами. Второе значение равно false,
+// если таблицу найти не удалось.
+func estimateJPEGQuality(data []byte) (int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, false
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 0, false
+		}
+		marker := data[i+1]
+		// Заполняющие байты 0xFF и маркеры без длины пропускаем.
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		// Таблицы квантования всегда идут до начала сканирования.
+		if marker == 0xDA || marker == 0xD9 {
+			return 0, false
+		}
+
+		length := int(data[i+2])<<8 | int(data[i+3])
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, false
+		}
+		if marker == 0xDB {
+			if q, ok := lumaQualityFromDQT(data[i+4 : end]); ok {
+				return q, true
+			}
+		}
+		i = end
+	}
+	return 0, false
+}
+
+// lumaQualityFromDQT ищет в сегменте DQT таблицу с номером 0 (яркость) и оценивает по ней качество.
+func lumaQualityFromDQT(seg []byte) (int, bool) {
+	for len(seg) > 0 {
+		precision, id := seg[0]>>4, seg[0]&0x0F
+		size := 64
+		if precision == 1 {
+			size = 128
+		}
+		if len(seg) < 1+size {
+			return 0, false
+		}
+		if id == 0 {
+			sum := 0
+			for k := 0; k < 64; k++ {
+				if precision == 1 {
+					sum += int(seg[1+2*k])<<8 | int(seg[2+2*k])
+				} else {
+					sum += int(seg[1+k])
+				}
+			}
+			return qualityFromTableSum(sum), true
+		}
+		seg = seg[1+size:]
+	}
+	return 0, false
+}
+
+// qualityFromTableSum находит качество Q (1–100), при котором сумма коэффициентов
+// масштабированной стандартной таблицы ближе всего к sum. Как и в libjpeg (и image/jpeg),
+// таблица с качеством Q равна стандартной, умноженной на 5000/Q (при Q < 50) или на 200-2Q
+// (при Q >= 50) и делённой на 100, с ограничением коэффициентов диапазоном 1–255.
+// Из-за этого ограничения простое обращение формулы сильно ошибается при низком качестве,
+// поэтому сравниваем с каждой возможной таблицей. Суммы коэффициентов не зависят от порядка
+// обхода (зигзаг), поэтому сравниваем их.
+func qualityFromTableSum(sum int) int {
+	best, bestDiff := 1, -1
+	for q := 1; q <= 100; q++ {
+		diff := scaledTableSum(q) - sum
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = q, diff
+		}
+	}
+	return best
+}
+
+// scaledTableSum возвращает сумму коэффициентов стандартной таблицы яркости,
+// масштабированной для качества q так же, как это делает libjpeg.
+func scaledTableSum(q int) int {
+	scale := 200 - 2*q
+	if q < 50 {
+		scale = 5000 / q
+	}
+	sum := 0
+	for _, v := range stdLuminanceTable {
+		x := (v*scale + 50) / 100
+		if x < 1 {
+			x = 1
+		} else if x > 255 {
+			x = 255
+		}
+		sum += x
+	}
+	return sum
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegBytes кодирует градиент 32×32 в JPEG с заданным качеством.
+func jpegBytes(t *testing.T, quality int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255})
+		}
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestEstimateJPEGQuality(t *testing.T) {
+	for _, quality := range []int{1, 3, 5, 10, 25, 50, 75, 90, 100} {
+		got, ok := estimateJPEGQuality(jpegBytes(t, quality))
+		if !ok {
+			t.Errorf("quality %d: no estimate", quality)
+			continue
+		}
+		if got != quality {
+			t.Errorf("quality %d: estimate %d", quality, got)
+		}
+	}
+
+	if _, ok := estimateJPEGQuality(pngBytes(1, 1)); ok {
+		t.Error("PNG got a JPEG quality estimate")
+	}
+}
+
+func TestLowQualityJPEGFlagged(t *testing.T) {
+	setVar(t, &minQuality, 10)
+
+	low := decodeImage("http://example.com/low.jpg", jpegBytes(t, 5))
+	if low.QualityEstimate > 7 || !low.LowQuality {
+		t.Errorf("quality 5: estimate %d, low=%v; want a low estimate flagged as low quality", low.QualityEstimate, low.LowQuality)
+	}
+
+	high := decodeImage("http://example.com/high.jpg", jpegBytes(t, 85))
+	if high.LowQuality {
+		t.Errorf("quality 85 flagged as low quality (estimate %d)", high.QualityEstimate)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// scrapeOptions — параметры одного сканирования, переданные в запросе.
+type scrapeOptions struct {
+	Depth   int    // Глубина обхода ссылок (0 — только указанная страница)
+	Referer string // Referer для загрузки изображений; по умолчанию — URL страницы
+	NoCache bool   // Не брать результат из кэша, а просканировать страницу заново
+}
+
+// parseScrapeOptions читает параметры сканирования из запроса: 'depth', 'referer' и 'nocache'.
+func parseScrapeOptions(r *http.Request) (scrapeOptions, error) {
+	depth, err := parseDepth(r)
+	if err != nil {
+		return scrapeOptions{}, err
+	}
+	opts := scrapeOptions{
+		Depth:   depth,
+		Referer: r.FormValue("referer"),
+	}
+	if v := r.FormValue("nocache"); v != "" {
+		if opts.NoCache, err = strconv.ParseBool(v); err != nil {
+			return scrapeOptions{}, fmt.Errorf("некорректное значение nocache %q", v)
+		}
+	}
+	return opts, nil
+}
+
+// imageHeader возвращает заголовки для загрузки изображений страницы pageURL.
+// Некоторые CDN отдают изображения только при Referer своей страницы.
+func (o scrapeOptions) imageHeader(pageURL string) http.Header {
+	referer := o.Referer
+	if referer == "" {
+		referer = pageURL
+	}
+	return http.Header{"Referer": {referer}}
+}
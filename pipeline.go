@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// fetchWorkers — размер пула сетевых загрузок (флаг -fetch-workers).
+var fetchWorkers = 8
+
+// decodeWorkers — размер отдельного пула декодирования (флаг -decode-workers).
+// Декодирование нагружает процессор, поэтому по умолчанию равно числу ядер.
+var decodeWorkers = runtime.NumCPU()
+
+// dedupContent включает объединение изображений с одинаковым содержимым (флаг -dedup-content).
+var dedupContent bool
+
+// fetchResult — результат обработки одного изображения; index — его позиция в документе,
+// hash — SHA-256 содержимого (вычисляется только при dedupContent).
+type fetchResult struct {
+	index int
+	image ImageData
+	hash  [sha256.Size]byte
+	err   error
+}
+
+// downloaded — тело изображения, загруженное сетевым пулом и ожидающее декодирования.
+type downloaded struct {
+	index        int
+	data         []byte
+	transferSize int64
+	err          error
+}
+
+// fetchAll загружает и декодирует изображения двумя ограниченными пулами горутин:
+// сетевым (fetchWorkers) и декодирующим (decodeWorkers). Результаты завершаются
+// в произвольном порядке, но буфер переупорядочивания передаёт их в emit строго
+// в порядке imageURLs. Тело изображения imageURLs[i] загружает download(i). emit вызывается из текущей горутины; если он возвращает false,
+// новые загрузки не начинаются, а оставшиеся результаты отбрасываются.
+func fetchAll(imageURLs []string, download func(index int) ([]byte, int64, error), emit func(fetchResult) bool) {
+	jobs := make(chan int)
+	bodies := make(chan downloaded)
+	results := make(chan fetchResult)
+	// done закрывается, когда emit просит остановиться.
+	done := make(chan struct{})
+
+	// Раздаём индексы изображений сетевому пулу.
+	go func() {
+		defer close(jobs)
+		for i := range imageURLs {
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Сетевой пул: загружает тела изображений.
+	var netWG sync.WaitGroup
+	for i := 0; i < fetchWorkers; i++ {
+		netWG.Add(1)
+		go func() {
+			defer netWG.Done()
+			for idx := range jobs {
+				// После остановки не начинаем новых загрузок, только разбираем очередь.
+				select {
+				case <-done:
+					continue
+				default:
+				}
+				data, transferSize, err := download(idx)
+				bodies <- downloaded{index: idx, data: data, transferSize: transferSize, err: err}
+			}
+		}()
+	}
+	go func() {
+		netWG.Wait()
+		close(bodies)
+	}()
+
+	// Пул декодирования: определяет размеры изображений.
+	var decodeWG sync.WaitGroup
+	for i := 0; i < decodeWorkers; i++ {
+		decodeWG.Add(1)
+		go func() {
+			defer decodeWG.Done()
+			for body := range bodies {
+				res := fetchResult{index: body.index, err: body.err}
+				if body.err == nil {
+					res.image = decodeImage(imageURLs[body.index], body.data)
+					res.image.TransferSize = body.transferSize
+					if dedupContent {
+						res.hash = sha256.Sum256(body.data)
+					}
+				}
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		decodeWG.Wait()
+		close(results)
+	}()
+
+	// Буфер переупорядочивания: держим результаты, пришедшие раньше своей очереди.
+	pending := make(map[int]fetchResult)
+	next := 0
+	stopped := false
+	for res := range results {
+		// После остановки дочитываем канал, чтобы горутины пулов завершились.
+		if stopped {
+			continue
+		}
+		pending[res.index] = res
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if !emit(ready) {
+				stopped = true
+				close(done)
+				break
+			}
+		}
+	}
+}
+
+// errSkipped возвращается вместо загрузки изображения, до которого сканирование
+// заведомо не дойдёт. Такие результаты никогда не передаются в emit.
+var errSkipped = errors.New("загрузка пропущена: сканирование остановлено")
+
+// largeTracker запоминает позиции уже загруженных больших изображений (см. -stop-after-large).
+// Если перед изображением уже загружено stopAfterLarge больших, сканирование остановится
+// раньше него, и загружать его не нужно. Методы нулевого указателя ничего не делают.
+type largeTracker struct {
+	mu    sync.Mutex
+	large []int
+}
+
+// add учитывает загруженное изображение с позицией index и размером size.
+func (t *largeTracker) add(index int, size int64) {
+	if t == nil || size <= largeThreshold {
+		return
+	}
+	t.mu.Lock()
+	t.large = append(t.large, index)
+	t.mu.Unlock()
+}
+
+// enough сообщает, загружено ли уже stopAfterLarge больших изображений перед позицией index.
+func (t *largeTracker) enough(index int) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, i := range t.large {
+		if i < index {
+			n++
+		}
+	}
+	return n >= stopAfterLarge
+}
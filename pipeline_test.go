@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestFetchAllKeepsDocumentOrder(t *testing.T) {
+	setVar(t, &fetchWorkers, 4)
+
+	// Первое изображение отвечает только после того, как отдано последнее,
+	// поэтому результаты завершаются в обратном порядке.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0.png":
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+				t.Error("last image was never requested")
+			}
+			w.Write(pngBytes(1, 1))
+		case "/2.png":
+			w.Write(pngBytes(3, 3))
+			w.(http.Flusher).Flush()
+			close(release)
+		default:
+			w.Write(pngBytes(2, 2))
+		}
+	}))
+	defer srv.Close()
+
+	var urls []string
+	for i := 0; i < 3; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d.png", srv.URL, i))
+	}
+
+	var got []int
+	download := func(i int) ([]byte, int64, error) {
+		return downloadImage(urls[i], nil)
+	}
+	fetchAll(urls, download, func(res fetchResult) bool {
+		if res.err != nil {
+			t.Errorf("%s: %v", urls[res.index], res.err)
+		}
+		if res.image.URL != urls[res.index] {
+			t.Errorf("result %d has URL %s", res.index, res.image.URL)
+		}
+		got = append(got, res.image.Width)
+		return true
+	})
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("widths in emit order = %v, want %v", got, want)
+	}
+}
+
+func TestStopAfterLarge(t *testing.T) {
+	setVar(t, &stopAfterLarge, 2)
+	setVar(t, &largeThreshold, 1000)
+	// С одним сетевым потоком загрузки идут строго по порядку, и видно, где сканирование остановилось.
+	setVar(t, &fetchWorkers, 1)
+
+	var large bytes.Buffer
+	if err := bmp.Encode(&large, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			io.WriteString(w, `<html><body>
+<img src="/s1.png"><img src="/l1.bmp"><img src="/s2.png"><img src="/l2.bmp"><img src="/l3.bmp"><img src="/s3.png"><img src="/l4.bmp">
+</body></html>`)
+			return
+		}
+		mu.Lock()
+		requested = append(requested, strings.TrimPrefix(r.URL.Path, "/"))
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, ".bmp") {
+			w.Write(large.Bytes())
+			return
+		}
+		w.Write(pngBytes(1, 1))
+	}))
+	defer srv.Close()
+
+	result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated {
+		t.Error("Truncated is not set")
+	}
+	want := []string{"s1.png", "l1.bmp", "s2.png", "l2.bmp"}
+	var got []string
+	for _, img := range result.Images {
+		got = append(got, strings.TrimPrefix(img.URL, srv.URL+"/"))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// После второго большого изображения ничего не загружается.
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %v, want only %v", requested, want)
+	}
+	if len(result.Failed) != 0 {
+		t.Errorf("skipped images reported as failed: %v", result.Failed)
+	}
+
+	// Если больших изображений меньше N, сканирование идёт до конца.
+	stopAfterLarge = 5
+	requested = nil
+	result, err = fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Truncated || len(result.Images) != 7 || len(requested) != 7 {
+		t.Errorf("N=5: got %d images from %d requests, truncated=%v; want all 7, not truncated",
+			len(result.Images), len(requested), result.Truncated)
+	}
+}
@@ -1,32 +1,140 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
 	"fmt"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-	_ "io"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/andybalholm/cascadia"
 	"github.com/gorilla/mux"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 	"golang.org/x/net/html"
 )
 
 type ImageData struct {
-	URL    string
-	Width  int
-	Height int
-	Size   int64
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"` // Размер после распаковки
+	// TransferSize — число байтов, переданных по сети (до распаковки gzip/deflate); 0 для data URI.
+	TransferSize int64 `json:"transfer_size"`
+	// QualityEstimate — оценка качества JPEG (1–100) по таблицам квантования; 0 для других форматов.
+	QualityEstimate int `json:"quality_estimate,omitempty"`
+	// LowQuality отмечает JPEG с оценкой качества ниже порога -min-quality.
+	LowQuality bool `json:"low_quality,omitempty"`
+	// RefCount — число просмотренных страниц, ссылающихся на изображение.
+	RefCount int `json:"ref_count"`
 }
 
+// FailedImage описывает изображение, которое не удалось загрузить, и причину ошибки.
+type FailedImage struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// ScrapeResult — итог сканирования страницы. TotalSize учитывает только успешно загруженные изображения.
+type ScrapeResult struct {
+	Images            []ImageData   `json:"images"`
+	TotalSize         int64         `json:"total_size"`
+	TotalTransferSize int64         `json:"total_transfer_size"`
+	Failed            []FailedImage `json:"failed"`
+	Warnings          []Warning     `json:"warnings"`
+	// Truncated означает, что сканирование остановлено досрочно (см. -stop-after-large).
+	Truncated bool `json:"truncated"`
+}
+
+// scanScripts включает эвристический поиск URL изображений внутри <script>
+// (например, в JSON с начальным состоянием SPA). Поиск неточный, поэтому по умолчанию выключен.
+var scanScripts bool
+
+// withinSelector ограничивает поиск изображений элементами, подходящими под CSS-селектор
+// (флаг -within, например ".gallery"). nil — искать по всей странице.
+var withinSelector cascadia.Selector
+
+// stopAfterLarge останавливает сканирование, как только найдено столько изображений
+// крупнее largeThreshold байт. 0 — сканировать все изображения.
+var stopAfterLarge int
+
+// largeThreshold — размер (в байтах), начиная с которого изображение считается большим.
+var largeThreshold int64 = 1 << 20
+
+// maxHosts ограничивает число различных хостов, с которых загружаются изображения.
+// Изображения с новых хостов после достижения лимита пропускаются. 0 — без ограничений.
+var maxHosts int
+
+// scriptImageRe находит строковые литералы, похожие на URL изображений.
+var scriptImageRe = regexp.MustCompile(`(?i)["']([^"'\s<>]+?\.(?:jpe?g|png|gif|webp|bmp|tiff?|svg|avif)(?:[?#][^"'\s<>]*)?)["']`)
+
+// styleURLRe находит ссылки url(...) в CSS: в одинарных, двойных кавычках или без них.
+var styleURLRe = regexp.MustCompile(`url\(\s*(?:'([^']*)'|"([^"]*)"|([^'")\s]+))\s*\)`)
+
 func main() {
+	flag.BoolVar(&scanScripts, "scan-scripts", false, "искать URL изображений внутри <script> (эвристика)")
+	flag.BoolVar(&blockPrivate, "block-private", true, "запрещать запросы к loopback, link-local и частным адресам")
+	within := flag.String("within", "", "искать изображения только внутри элементов, подходящих под CSS-селектор")
+	extList := flag.String("only-extensions", "", "загружать только изображения с этими расширениями, через запятую (например, png,svg)")
+	flag.IntVar(&stopAfterLarge, "stop-after-large", 0, "остановить сканирование после N изображений крупнее -large-threshold (0 — не останавливать)")
+	flag.Int64Var(&largeThreshold, "large-threshold", largeThreshold, "размер в байтах, начиная с которого изображение считается большим")
+	flag.BoolVar(&dedupContent, "dedup-content", false, "объединять изображения с одинаковым содержимым под разными URL")
+	flag.IntVar(&maxHosts, "max-hosts", 0, "максимальное число различных хостов изображений (0 — без ограничений)")
+	flag.IntVar(&fetchWorkers, "fetch-workers", fetchWorkers, "число параллельных загрузок изображений")
+	flag.IntVar(&decodeWorkers, "decode-workers", decodeWorkers, "число параллельных декодирований изображений")
+	flag.IntVar(&minQuality, "min-quality", 0, "помечать JPEG с оценкой качества ниже порога (0 — не проверять)")
+	flag.StringVar(&userAgent, "user-agent", os.Getenv("SCRAPER_USER_AGENT"), "User-Agent для исходящих запросов (по умолчанию — $SCRAPER_USER_AGENT или браузера устройства -device)")
+	flag.DurationVar(&cacheTTL, "cache-ttl", cacheTTL, "время хранения результатов сканирования в кэше (0 — без кэша; не действует при -db и -save-dir)")
+	flag.IntVar(&maxDepth, "max-depth", maxDepth, "максимальная глубина обхода ссылок, доступная в параметре depth")
+	flag.StringVar(&device, "device", device, "устройство, от имени которого выполняются запросы: desktop или mobile")
+	flag.StringVar(&saveDir, "save-dir", "", "каталог для сохранения найденных изображений (с докачкой прерванных загрузок)")
+	dbPath := flag.String("db", "", "путь к базе SQLite для сохранения истории сканирований")
+	flag.Parse()
+
+	if *within != "" {
+		sel, err := cascadia.Compile(*within)
+		if err != nil {
+			log.Fatalf("некорректный селектор -within %q: %v", *within, err)
+		}
+		withinSelector = sel
+	}
+	if *extList != "" {
+		onlyExtensions = parseExtensions(*extList)
+	}
+	if fetchWorkers < 1 || decodeWorkers < 1 {
+		log.Fatal("-fetch-workers и -decode-workers должны быть не меньше 1")
+	}
+	if _, ok := deviceUserAgents[device]; !ok {
+		log.Fatalf("неизвестное устройство %q: ожидается desktop или mobile", device)
+	}
+
+	if *dbPath != "" {
+		conn, err := openDB(*dbPath)
+		if err != nil {
+			log.Fatalf("не удалось открыть базу %s: %v", *dbPath, err)
+		}
+		defer conn.Close()
+		db = conn
+	}
+
 	r := mux.NewRouter()
 	r.HandleFunc("/", HomeHandler).Methods("GET")
 	r.HandleFunc("/go", GoHandler).Methods("POST")
+	r.HandleFunc("/api", APIHandler).Methods("GET")
+	r.HandleFunc("/download", DownloadHandler).Methods("GET", "POST")
+	r.HandleFunc("/compare", CompareHandler).Methods("GET")
 	http.Handle("/", r)
 	fmt.Println("Server listening on http://localhost:8081")
 	http.ListenAndServe(":8081", nil)
@@ -40,7 +148,20 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
  <body>
   <form action="/go" method="post">
    URL: <input type="text" name="url">
+   <label><input type="checkbox" name="depth" value="1"> со ссылками</label>
+   <select name="sort">
+    <option value="">в порядке страницы</option>
+    <option value="size">по размеру файла</option>
+    <option value="width">по ширине</option>
+    <option value="height">по высоте</option>
+    <option value="name">по имени</option>
+   </select>
+   <select name="order">
+    <option value="asc">по возрастанию</option>
+    <option value="desc">по убыванию</option>
+   </select>
    <button type="submit">Go</button>
+   <button type="submit" formaction="/download">ZIP</button>
   </form>
  </body>
  </html>`)
@@ -54,148 +175,560 @@ func GoHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем значение параметра 'url' из формы запроса.
 	inputURL := r.FormValue("url")
 
+	// Получаем параметры сканирования: глубину обхода ссылок и Referer.
+	opts, err := parseScrapeOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Получаем порядок сортировки результатов.
+	order, err := parseSortOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Извлекаем изображения и их общий размер с указанного URL.
-	images, totalSize, err := fetchImages(inputURL)
+	result, err := fetchImages(inputURL, opts)
 	if err != nil {
 		// В случае ошибки при извлечении изображений возвращаем внутреннюю ошибку сервера.
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Отображаем результат, используя извлеченные изображения и их общий размер.
-	renderResult(w, images, totalSize)
+	// Сортируем изображения, если это запрошено.
+	order.apply(result.Images)
+
+	// Дублируем сводку в заголовках для клиентов, которые не читают тело ответа.
+	setSummaryHeaders(w, result)
+
+	// Отображаем результат: найденные изображения, их общий размер и ошибки загрузки.
+	renderResult(w, result)
 }
 
-// fetchImages загружает изображения с указанной страницы и возвращает их данные и общий размер.
-func fetchImages(pageURL string) ([]ImageData, int64, error) {
+// fetchImages загружает изображения с указанной страницы и возвращает их данные, общий размер
+// и список изображений, которые загрузить не удалось.
+func fetchImages(pageURL string, opts scrapeOptions) (ScrapeResult, error) {
+	// Сканирование, которое записывает историю в базу или файлы на диск, всегда выполняется
+	// заново: иначе повторный запрос в пределах cacheTTL ничего бы не записал.
+	useCache := db == nil && saveDir == ""
+
+	// Возвращаем результат из кэша, если он есть и обновление не запрошено.
+	key := cacheKey(pageURL, opts)
+	if useCache && !opts.NoCache {
+		if cached, ok := pageCache.get(key); ok {
+			return cached, nil
+		}
+	}
+
+	// Находим URL-адреса изображений на странице.
+	disc, err := discoverImageURLs(pageURL, opts.Depth)
+	if err != nil {
+		return ScrapeResult{}, err
+	}
+	imageURLs := disc.URLs
+	result := ScrapeResult{Warnings: disc.Warnings}
+
+	// Позиции изображений в результате по хэшу содержимого (при -dedup-content).
+	byHash := make(map[[sha256.Size]byte]int)
+	// Число найденных больших изображений (при -stop-after-large).
+	large := 0
+
+	header := opts.imageHeader(pageURL)
+	fetch := func(imgURL string) ([]byte, int64, error) {
+		return downloadImage(imgURL, header)
+	}
+	// Если задан каталог, сохраняем изображения на диск по ходу загрузки, не скачивая их повторно.
+	var save *dirSave
+	if saveDir != "" {
+		if save, err = beginSave(saveDir, imageURLs); err != nil {
+			log.Printf("не удалось подготовить сохранение %s в %s: %v", pageURL, saveDir, err)
+		} else {
+			fetch = func(imgURL string) ([]byte, int64, error) {
+				return save.download(imgURL, header)
+			}
+		}
+	}
+
+	// При -stop-after-large не начинаем загрузки, до которых сканирование уже не дойдёт.
+	// С -dedup-content повторы не считаются большими, поэтому там остановка происходит только в emit.
+	var tracker *largeTracker
+	if stopAfterLarge > 0 && !dedupContent {
+		tracker = &largeTracker{}
+	}
+	download := func(index int) ([]byte, int64, error) {
+		if tracker.enough(index) {
+			return nil, 0, errSkipped
+		}
+		data, transferSize, err := fetch(imageURLs[index])
+		if err == nil {
+			tracker.add(index, int64(len(data)))
+		}
+		return data, transferSize, err
+	}
+
+	// Загружаем и декодируем изображения параллельно; результаты приходят в порядке документа.
+	fetchAll(imageURLs, download, func(res fetchResult) bool {
+		if res.err != nil {
+			// Запоминаем причину ошибки, чтобы показать её пользователю.
+			result.Failed = append(result.Failed, FailedImage{URL: imageURLs[res.index], Error: res.err.Error()})
+			return true
+		}
+		res.image.RefCount = disc.RefCounts[res.image.URL]
+		// Одинаковое содержимое под разными URL считаем одним изображением и складываем ссылки
+		// (страница, на которой есть оба URL, при этом учитывается дважды).
+		if dedupContent {
+			if i, ok := byHash[res.hash]; ok {
+				result.Images[i].RefCount += res.image.RefCount
+				return true
+			}
+			byHash[res.hash] = len(result.Images)
+		}
+		// Если загрузка изображения успешна, добавляем его данные в список и увеличиваем общий размер.
+		result.Images = append(result.Images, res.image)
+		result.TotalSize += res.image.Size
+		result.TotalTransferSize += res.image.TransferSize
+
+		// Останавливаемся, как только найдено достаточно больших изображений,
+		// если после текущего ещё остались необработанные.
+		if stopAfterLarge > 0 && res.image.Size > largeThreshold {
+			large++
+			if large >= stopAfterLarge && res.index < len(imageURLs)-1 {
+				result.Truncated = true
+				return false
+			}
+		}
+		return true
+	})
+
+	// Сохраняем результаты в историю, если база подключена.
+	if db != nil {
+		if err := saveImages(db, pageURL, result.Images); err != nil {
+			log.Printf("не удалось сохранить результаты для %s: %v", pageURL, err)
+		}
+	}
+
+	// Записываем описание сохранённых на диск изображений.
+	if save != nil {
+		if err := save.finish(result.Images); err != nil {
+			log.Printf("не удалось сохранить изображения %s в %s: %v", pageURL, saveDir, err)
+		}
+	}
+
+	// Запоминаем результат для повторных запросов той же страницы.
+	if useCache {
+		pageCache.set(key, result)
+	}
+
+	// Возвращаем результат сканирования.
+	return result, nil
+}
+
+// discoverImageURLs загружает страницу и возвращает найденные на ней URL изображений
+// с учётом ограничения на число хостов, число ссылающихся страниц для каждого изображения
+// и предупреждения, собранные при разборе. При depth > 0 также просматриваются страницы
+// того же источника, на которые ведут ссылки (см. crawlLinkedPages).
+func discoverImageURLs(pageURL string, depth int) (discovery, error) {
+	// Загружаем и парсим HTML-документ.
+	doc, err := fetchPage(pageURL, false)
+	if err != nil {
+		return discovery{}, err
+	}
+
+	// Извлекаем URL-адреса изображений из HTML-документа.
+	imageURLs, warnings, err := extractImageURLs(doc, pageURL)
+	if err != nil {
+		return discovery{}, err
+	}
+	disc := discovery{URLs: imageURLs, RefCounts: make(map[string]int), Warnings: warnings}
+	addPageRefs(disc.RefCounts, imageURLs)
+	if depth > 0 {
+		disc = crawlLinkedPages(doc, pageURL, disc, depth)
+	}
+	// Каждое изображение загружаем один раз; ненужные форматы отбрасываем до ограничения
+	// по хостам, чтобы они не занимали лимит.
+	disc.URLs = limitHosts(filterExtensions(uniqueURLs(disc.URLs)))
+	return disc, nil
+}
+
+// fetchPage загружает страницу и возвращает её разобранный HTML-документ.
+// Если requireHTML равен true, ответы с другим Content-Type отклоняются.
+func fetchPage(pageURL string, requireHTML bool) (*html.Node, error) {
+	// Проверяем, что URL безопасен для запроса.
+	if err := validateURL(pageURL); err != nil {
+		return nil, err
+	}
+
 	// Отправляем HTTP GET запрос на указанный URL.
-	resp, err := http.Get(pageURL)
+	resp, err := doGet(pageURL, nil)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	// Закрываем тело ответа после завершения функции.
 	defer resp.Body.Close()
 
-	// Парсим HTML-документ из тела ответа.
-	doc, err := html.Parse(resp.Body)
-	if err != nil {
-		return nil, 0, err
+	if requireHTML {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: статус ответа %s", pageURL, resp.Status)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "html") {
+			return nil, fmt.Errorf("%s: не HTML-страница (%s)", pageURL, ct)
+		}
 	}
 
-	// Извлекаем URL-адреса изображений из HTML-документа.
-	imageURLs := extractImageURLs(doc, pageURL)
-	var images []ImageData
-	var totalSize int64
+	// Парсим HTML-документ из тела ответа.
+	return html.Parse(resp.Body)
+}
 
-	// Проходим по каждому URL изображения и загружаем его данные.
+// limitHosts оставляет только изображения с первых maxHosts различных хостов.
+func limitHosts(imageURLs []string) []string {
+	if maxHosts <= 0 {
+		return imageURLs
+	}
+
+	// Множество хостов, к которым уже были обращения.
+	hosts := make(map[string]bool)
+	var limited []string
 	for _, imgURL := range imageURLs {
-		imgData, err := fetchImage(imgURL)
-		if err == nil {
-			// Если загрузка изображения успешна, добавляем его данные в список и увеличиваем общий размер.
-			images = append(images, imgData)
-			totalSize += imgData.Size
+		u, err := url.Parse(imgURL)
+		if err != nil {
+			continue
 		}
+		// Пропускаем изображения с новых хостов, если лимит хостов исчерпан.
+		// Встроенные data URI не требуют обращения к хосту и не ограничиваются.
+		if u.Host != "" && !hosts[u.Host] {
+			if len(hosts) >= maxHosts {
+				continue
+			}
+			hosts[u.Host] = true
+		}
+		limited = append(limited, imgURL)
 	}
-
-	// Возвращаем список данных изображений и общий размер.
-	return images, totalSize, nil
+	return limited
 }
 
-func extractImageURLs(n *html.Node, baseURL string) []string {
+func extractImageURLs(n *html.Node, baseURL string) ([]string, []Warning, error) {
+	// Парсим базовый URL, относительно которого разрешаются ссылки
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("некорректный базовый URL %q: %w", baseURL, err)
+	}
+
 	// Слайс для хранения найденных URL изображений
 	var imageURLs []string
+	// Предупреждения о признаках пропущенных изображений
+	var warnings []Warning
 
 	// Определяем функцию crawler для рекурсивного обхода дерева узлов HTML
 	var crawler func(*html.Node)
 	crawler = func(node *html.Node) {
-		// Проверяем, является ли текущий узел элементом <img>
-		if node.Type == html.ElementNode && node.Data == "img" {
-			// Проходим по всем атрибутам элемента <img>
+		// Проверяем, является ли текущий узел элементом <img> или <input type="image">
+		if node.Type == html.ElementNode && (node.Data == "img" || isImageInput(node)) {
+			if node.Data == "img" {
+				warnings = append(warnings, imgWarnings(node, baseURL)...)
+			}
+			// Проходим по всем атрибутам элемента
 			for _, attr := range node.Attr {
 				// Ищем атрибут "src", содержащий URL изображения
 				if attr.Key == "src" {
-					imgURL := attr.Val
-					// Если URL не абсолютный (не начинается с "http"), преобразуем его в абсолютный
-					if !strings.HasPrefix(imgURL, "http") {
-						base, _ := url.Parse(baseURL)                // Парсим базовый URL
-						ref, _ := url.Parse(imgURL)                  // Парсим относительный URL изображения
-						imgURL = base.ResolveReference(ref).String() // Разрешаем относительный URL относительно базового
+					// Встроенные изображения data:image/... загружать не нужно, сохраняем их как есть
+					if isDataImageURL(attr.Val) {
+						imageURLs = append(imageURLs, strings.TrimSpace(attr.Val))
+						continue
+					}
+					// Добавляем найденный URL изображения в слайс, если его можно загрузить
+					if imgURL, ok := resolveURL(base, attr.Val); ok {
+						imageURLs = append(imageURLs, imgURL)
 					}
-					// Добавляем найденный URL изображения в слайс
-					imageURLs = append(imageURLs, imgURL)
 				}
 			}
 		}
+		// Ищем фоновые изображения в атрибуте style любого элемента
+		if node.Type == html.ElementNode {
+			for _, attr := range node.Attr {
+				if attr.Key == "style" {
+					imageURLs = append(imageURLs, extractStyleImageURLs(attr.Val, base)...)
+				}
+			}
+		}
+		// Если включена эвристика, ищем URL изображений в содержимом <script>
+		if scanScripts && node.Type == html.ElementNode && node.Data == "script" {
+			imageURLs = append(imageURLs, extractScriptImageURLs(node, base)...)
+		}
 		// Рекурсивно обходим всех потомков текущего узла
 		for c := node.FirstChild; c != nil; c = c.NextSibling {
 			crawler(c)
 		}
 	}
 
-	// Запускаем рекурсивный обход с корневого узла
-	crawler(n)
+	// Запускаем рекурсивный обход с корневого узла или, если задан -within,
+	// только с элементов, подходящих под селектор
+	for _, root := range extractionRoots(n) {
+		crawler(root)
+	}
+
+	// Возвращаем слайс найденных URL изображений и предупреждения
+	return imageURLs, warnings, nil
+}
+
+// extractionRoots возвращает узлы, с которых начинается поиск изображений: весь документ
+// или, если задан селектор withinSelector, подходящие под него элементы. Вложенные совпадения
+// отбрасываются, чтобы изображения внутри них не учитывались дважды.
+func extractionRoots(n *html.Node) []*html.Node {
+	if withinSelector == nil {
+		return []*html.Node{n}
+	}
+	matches := withinSelector.MatchAll(n)
+	matched := make(map[*html.Node]bool, len(matches))
+	for _, m := range matches {
+		matched[m] = true
+	}
+	var roots []*html.Node
+	for _, m := range matches {
+		nested := false
+		for p := m.Parent; p != nil; p = p.Parent {
+			if matched[p] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			roots = append(roots, m)
+		}
+	}
+	return roots
+}
+
+// isImageInput сообщает, является ли узел графической кнопкой <input type="image">.
+func isImageInput(node *html.Node) bool {
+	if node.Data != "input" {
+		return false
+	}
+	for _, attr := range node.Attr {
+		if attr.Key == "type" {
+			return strings.EqualFold(strings.TrimSpace(attr.Val), "image")
+		}
+	}
+	return false
+}
+
+// extractScriptImageURLs собирает из текста элемента <script> строки, похожие на URL изображений.
+func extractScriptImageURLs(script *html.Node, base *url.URL) []string {
+	var text strings.Builder
+	for c := script.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			text.WriteString(c.Data)
+		}
+	}
+
+	var imageURLs []string
+	for _, m := range scriptImageRe.FindAllStringSubmatch(text.String(), -1) {
+		// В JSON слэши часто экранированы: "https:\/\/x\/img.jpg"
+		imgURL := strings.ReplaceAll(m[1], `\/`, "/")
+		if imgURL, ok := resolveURL(base, imgURL); ok {
+			imageURLs = append(imageURLs, imgURL)
+		}
+	}
+	return imageURLs
+}
 
-	// Возвращаем слайс найденных URL изображений
+// extractStyleImageURLs собирает ссылки url(...) из значения атрибута style.
+// Data URI пропускаются.
+func extractStyleImageURLs(style string, base *url.URL) []string {
+	var imageURLs []string
+	for _, m := range styleURLRe.FindAllStringSubmatch(style, -1) {
+		// Значение находится в одной из трёх групп в зависимости от кавычек
+		if imgURL, ok := resolveURL(base, m[1]+m[2]+m[3]); ok {
+			imageURLs = append(imageURLs, imgURL)
+		}
+	}
 	return imageURLs
 }
 
-// fetchImage получает изображение по заданному URL и возвращает информацию об изображении
-// такую как URL, ширина, высота и размер файла.
-func fetchImage(imgURL string) (ImageData, error) {
+// resolveURL преобразует URL изображения в абсолютный относительно base.
+// Протокол-относительные ссылки (//cdn.example.com/a.jpg) наследуют схему base.
+// Второе значение равно false, если ссылка пуста, некорректна или использует
+// схему, которую нельзя загрузить по HTTP (data:, javascript:, blob: и т.п.).
+func resolveURL(base *url.URL, imgURL string) (string, bool) {
+	imgURL = strings.TrimSpace(imgURL)
+	if imgURL == "" {
+		return "", false
+	}
+	ref, err := url.Parse(imgURL) // Парсим URL изображения
+	if err != nil {
+		return "", false
+	}
+	abs := base.ResolveReference(ref) // Разрешаем URL относительно базового
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return "", false
+	}
+	return abs.String(), true
+}
+
+// downloadImage загружает тело изображения по заданному URL. Заголовки header добавляются к запросу.
+// Помимо распакованных данных возвращает число байтов, фактически переданных по сети.
+func downloadImage(imgURL string, header http.Header) ([]byte, int64, error) {
+	// Встроенное изображение декодируем прямо из URL, без HTTP-запроса
+	if isDataImageURL(imgURL) {
+		data, err := decodeDataURL(imgURL)
+		return data, 0, err
+	}
+
 	// Отправляем HTTP GET запрос по URL
-	resp, err := http.Get(imgURL)
+	resp, err := getImage(imgURL, header)
 	if err != nil {
-		// Если произошла ошибка при отправке запроса, возвращаем пустую структуру ImageData и ошибку
-		return ImageData{}, err
+		return nil, 0, err
 	}
 
 	// Закрываем тело ответа, когда функция завершит выполнение, чтобы освободить ресурсы
 	defer resp.Body.Close()
 
-	// Декодируем изображение из тела ответа
-	img, _, err := image.Decode(resp.Body)
-	if err != nil {
-		// Если произошла ошибка при декодировании, возвращаем пустую структуру ImageData и ошибку
-		return ImageData{}, err
+	// Читаем тело ответа целиком: размер считаем по фактически полученным (распакованным) байтам,
+	// так как заголовок Content-Length может отсутствовать
+	data, err := io.ReadAll(resp.Body)
+	return data, transferSize(resp.Body), err
+}
+
+// decodeImage возвращает информацию о загруженном изображении:
+// URL, ширину, высоту и размер файла.
+func decodeImage(imgURL string, data []byte) ImageData {
+	imgData := ImageData{
+		URL:  imgURL,           // URL изображения
+		Size: int64(len(data)), // Размер файла
 	}
 
-	// Получаем размер изображения из заголовка ответа и преобразуем его в целое число
-	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
-	if err != nil {
-		// Если произошла ошибка при преобразовании размера, возвращаем пустую структуру ImageData и ошибку
-		return ImageData{}, err
+	// Для SVG декодера растровых форматов нет: берём размеры из атрибутов <svg>
+	if isSVG(imgURL, data) {
+		imgData.Width, imgData.Height = svgSize(data)
+		return imgData
+	}
+
+	// Декодируем изображение, чтобы узнать его ширину и высоту.
+	// Если формат не поддерживается, оставляем изображение с нулевыми размерами,
+	// чтобы общий объём оставался точным
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err == nil {
+		imgData.Width = img.Bounds().Dx()  // Ширина изображения
+		imgData.Height = img.Bounds().Dy() // Высота изображения
+	}
+
+	// Для JPEG оцениваем качество сжатия по таблицам квантования
+	if format == "jpeg" {
+		if q, ok := estimateJPEGQuality(data); ok {
+			imgData.QualityEstimate = q
+			imgData.LowQuality = minQuality > 0 && q < minQuality
+		}
 	}
 
 	// Возвращаем заполненную структуру ImageData
-	return ImageData{
-		URL:    imgURL,            // URL изображения
-		Width:  img.Bounds().Dx(), // Ширина изображения
-		Height: img.Bounds().Dy(), // Высота изображения
-		Size:   size,              // Размер файла
-	}, nil
+	return imgData
+}
+
+// getImage выполняет GET-запрос к изображению и проверяет, что сервер вернул успешный ответ.
+// Вызывающая сторона должна закрыть тело ответа.
+func getImage(imgURL string, header http.Header) (*http.Response, error) {
+	// Проверяем, что URL безопасен для запроса
+	if err := validateURL(imgURL); err != nil {
+		return nil, err
+	}
+
+	resp, err := doGet(imgURL, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: статус ответа %s", imgURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// setSummaryHeaders записывает в заголовки ответа число найденных изображений и их общий размер.
+func setSummaryHeaders(w http.ResponseWriter, result ScrapeResult) {
+	w.Header().Set("X-Image-Count", strconv.Itoa(len(result.Images)))
+	w.Header().Set("X-Total-Bytes", strconv.FormatInt(result.TotalSize, 10))
 }
 
 func formatSize(size int64) string {
+	if size < 1024*1024 {
+		return fmt.Sprintf("%.2f KB", float64(size)/1024)
+	}
 	return fmt.Sprintf("%.2f MB", float64(size)/1024/1024)
 }
 
-func renderResult(w http.ResponseWriter, images []ImageData, totalSize int64) {
+// formatQuality возвращает подпись с оценкой качества JPEG или пустую строку для других форматов.
+func formatQuality(img ImageData) string {
+	if img.QualityEstimate == 0 {
+		return ""
+	}
+	if img.LowQuality {
+		return fmt.Sprintf(", качество ≈%d (низкое)", img.QualityEstimate)
+	}
+	return fmt.Sprintf(", качество ≈%d", img.QualityEstimate)
+}
+
+// formatRefCount возвращает подпись с числом ссылающихся страниц, если их больше одной.
+func formatRefCount(img ImageData) string {
+	if img.RefCount <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(", встречается на %d стр.", img.RefCount)
+}
+
+func renderResult(w http.ResponseWriter, result ScrapeResult) {
 	fmt.Fprintf(w, `<html>
  <head>
   <title>Image Scraper Result</title>
  </head>
  <body>
   <div>
-   <h3>Найдено изображений: %d с общим объёмом %s</h3>
+   <h3>Найдено изображений: %d с общим объёмом %s (передано по сети %s)</h3>
   </div>
-  <div style="display: flex; flex-wrap: wrap;">`, len(images), formatSize(totalSize))
-	for _, img := range images {
+  <div style="display: flex; flex-wrap: wrap;">`, len(result.Images), formatSize(result.TotalSize), formatSize(result.TotalTransferSize))
+	for _, img := range result.Images {
 		fmt.Fprintf(w, `<div style="width: 25%%; padding: 5px;">
 
    <img src="%s" style="max-width: 100%%;">
-   </div>`, img.URL)
+   <div>%d×%d, %s%s%s</div>
+   </div>`, html.EscapeString(img.URL), img.Width, img.Height, formatSize(img.Size), formatQuality(img), formatRefCount(img))
+	}
+	fmt.Fprintf(w, `</div>`)
+	if result.Truncated {
+		fmt.Fprintf(w, `
+  <div>
+   <p>Сканирование остановлено досрочно: найдено %d изображений крупнее %s.</p>
+  </div>`, stopAfterLarge, formatSize(largeThreshold))
+	}
+	// Показываем изображения, которые не удалось загрузить, с причиной ошибки
+	if len(result.Failed) > 0 {
+		fmt.Fprintf(w, `
+  <div>
+   <h3>Не удалось загрузить: %d</h3>
+   <ul>`, len(result.Failed))
+		for _, f := range result.Failed {
+			fmt.Fprintf(w, `
+    <li><a href="%s">%s</a> — %s</li>`, html.EscapeString(f.URL), html.EscapeString(f.URL), html.EscapeString(f.Error))
+		}
+		fmt.Fprintf(w, `
+   </ul>
+  </div>`)
+	}
+	// Показываем предупреждения о возможных пропущенных изображениях
+	if len(result.Warnings) > 0 {
+		fmt.Fprintf(w, `
+  <div>
+   <h3>Предупреждения: %d</h3>
+   <ul>`, len(result.Warnings))
+		for _, warn := range result.Warnings {
+			fmt.Fprintf(w, `
+    <li>%s — %s</li>`, html.EscapeString(warn.Page), html.EscapeString(warn.Message))
+		}
+		fmt.Fprintf(w, `
+   </ul>
+  </div>`)
 	}
-	fmt.Fprintf(w, `</div>
+	fmt.Fprintf(w, `
  </body>
  </html>`)
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/net/html"
+)
+
+func TestMain(m *testing.M) {
+	// Тестовые серверы слушают на 127.0.0.1, а результаты одного теста не должны
+	// попадать в другой через кэш.
+	blockPrivate = false
+	cacheTTL = 0
+	os.Exit(m.Run())
+}
+
+// setVar присваивает значение глобальной настройке на время теста.
+func setVar[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// pngBytes кодирует пустое PNG-изображение размером w×h.
+func pngBytes(w, h int) []byte {
+	var b bytes.Buffer
+	png.Encode(&b, image.NewRGBA(image.Rect(0, 0, w, h)))
+	return b.Bytes()
+}
+
+// newSite запускает тестовый сервер: пути из pages отдаются как HTML,
+// любой другой путь — как PNG 10×20.
+func newSite(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := pages[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, p)
+			return
+		}
+		w.Write(pngBytes(10, 20))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// extract разбирает HTML и возвращает найденные в нём URL изображений.
+func extract(t *testing.T, doc, baseURL string) []string {
+	t.Helper()
+	n, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls, _, err := extractImageURLs(n, baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return urls
+}
+
+// imageURLs возвращает URL изображений результата в порядке вывода.
+func imageURLs(images []ImageData) []string {
+	var urls []string
+	for _, img := range images {
+		urls = append(urls, img.URL)
+	}
+	return urls
+}
+
+func TestExtractScriptImageURLs(t *testing.T) {
+	const doc = `<html><body>
+<img src="/a.png">
+<script>window.__STATE__ = {"hero": "https://x/img.jpg", "count": 3};</script>
+</body></html>`
+
+	setVar(t, &scanScripts, false)
+	if got, want := extract(t, doc, "http://example.com/"), []string{"http://example.com/a.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scanScripts=false: got %v, want %v", got, want)
+	}
+
+	scanScripts = true
+	if got, want := extract(t, doc, "http://example.com/"), []string{"http://example.com/a.png", "https://x/img.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scanScripts=true: got %v, want %v", got, want)
+	}
+}
+
+func TestMaxHosts(t *testing.T) {
+	setVar(t, &maxHosts, 2)
+
+	// Четыре хоста изображений (разные порты), каждый считает обращения к себе.
+	hits := make([]int32, 4)
+	var imgs strings.Builder
+	for i := range hits {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+			w.Write(pngBytes(1, 1))
+		}))
+		t.Cleanup(srv.Close)
+		imgs.WriteString(`<img src="` + srv.URL + `/a.png"><img src="` + srv.URL + `/b.png">`)
+	}
+	site := newSite(t, map[string]string{"/": "<html><body>" + imgs.String() + "</body></html>"})
+
+	result, err := fetchImages(site.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Images) != 4 {
+		t.Errorf("got %d images, want 4 from the first two hosts", len(result.Images))
+	}
+	if want := []int32{2, 2, 0, 0}; !reflect.DeepEqual(hits, want) {
+		t.Errorf("requests per host = %v, want %v", hits, want)
+	}
+}
+
+func TestDecodeImageFormats(t *testing.T) {
+	// Минимальный WebP 1×1 (lossless): в golang.org/x/image нет кодировщика WebP.
+	webpData, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bmpData, tiffData bytes.Buffer
+	if err := bmp.Encode(&bmpData, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := tiff.Encode(&tiffData, image.NewRGBA(image.Rect(0, 0, 4, 5)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+	}{
+		{"a.webp", webpData, 1, 1},
+		{"a.bmp", bmpData.Bytes(), 3, 2},
+		{"a.tiff", tiffData.Bytes(), 4, 5},
+		{"a.png", pngBytes(6, 7), 6, 7},
+		// Неизвестный формат остаётся с нулевыми размерами, но с размером файла.
+		{"a.xyz", []byte("not an image"), 0, 0},
+	}
+	for _, tt := range tests {
+		img := decodeImage("http://example.com/"+tt.name, tt.data)
+		if img.Width != tt.width || img.Height != tt.height || img.Size != int64(len(tt.data)) {
+			t.Errorf("%s: got %d×%d, %d bytes; want %d×%d, %d bytes",
+				tt.name, img.Width, img.Height, img.Size, tt.width, tt.height, len(tt.data))
+		}
+	}
+}
+
+func TestUndecodableImageKeptInTotals(t *testing.T) {
+	pngData := pngBytes(10, 20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><body><img src="/a.png"><img src="/broken.img"></body></html>`)
+		case "/broken.img":
+			io.WriteString(w, "garbage")
+		default:
+			w.Write(pngData)
+		}
+	}))
+	defer srv.Close()
+
+	result, err := fetchImages(srv.URL+"/", scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Images) != 2 || len(result.Failed) != 0 {
+		t.Fatalf("got %d images and %d failures, want 2 and 0", len(result.Images), len(result.Failed))
+	}
+	if broken := result.Images[1]; broken.Width != 0 || broken.Height != 0 || broken.Size != int64(len("garbage")) {
+		t.Errorf("undecodable image = %+v, want zero dimensions and size %d", broken, len("garbage"))
+	}
+	if want := int64(len(pngData) + len("garbage")); result.TotalSize != want {
+		t.Errorf("TotalSize = %d, want %d", result.TotalSize, want)
+	}
+}
+
+func TestExtractStyleImageURLs(t *testing.T) {
+	const doc = `<html><body>
+<div style="background-image:url('/bg.jpg')"></div>
+<section style='background: url("hero.png") no-repeat'></section>
+<span style="background-image: url( //cdn.example.com/c.webp )"></span>
+<p style="background-image:url(data:image/png;base64,AAAA)"></p>
+</body></html>`
+
+	got := extract(t, doc, "https://example.com/page/index.html")
+	want := []string{
+		"https://example.com/bg.jpg",
+		"https://example.com/page/hero.png",
+		"https://cdn.example.com/c.webp",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExtractImageInput(t *testing.T) {
+	const doc = `<html><body><form>
+<input type="image" src="btn.png">
+<input type="IMAGE" src="/icons/go.gif">
+<input type="text" src="ignored.png">
+</form></body></html>`
+
+	got := extract(t, doc, "http://example.com/forms/")
+	want := []string{"http://example.com/forms/btn.png", "http://example.com/icons/go.gif"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGoHandlerSummaryHeaders(t *testing.T) {
+	site := newSite(t, map[string]string{"/": `<html><body><img src="/a.png"><img src="/b.png"><img src="/c.png"></body></html>`})
+
+	form := url.Values{"url": {site.URL + "/"}}
+	req := httptest.NewRequest("POST", "/go", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	GoHandler(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	if got := rec.Header().Get("X-Image-Count"); got != "3" {
+		t.Errorf("X-Image-Count = %q, want 3", got)
+	}
+	if got, want := rec.Header().Get("X-Total-Bytes"), strconv.Itoa(3*len(pngBytes(10, 20))); got != want {
+		t.Errorf("X-Total-Bytes = %q, want %s", got, want)
+	}
+}
+
+func TestWithinSelector(t *testing.T) {
+	sel, err := cascadia.Compile(".gallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVar(t, &withinSelector, sel)
+
+	const doc = `<html><body>
+<img src="/header.png">
+<div class="gallery">
+  <img src="/g1.png">
+  <div class="gallery"><img src="/g2.png"></div>
+  <div style="background-image:url(/g3.jpg)"></div>
+</div>
+<aside><img src="/ad.png"></aside>
+<section class="wide gallery"><img src="/g4.png"></section>
+</body></html>`
+
+	got := extract(t, doc, "http://example.com/")
+	want := []string{"http://example.com/g1.png", "http://example.com/g2.png", "http://example.com/g3.jpg", "http://example.com/g4.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
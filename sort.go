@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// imageLess сравнивает изображения по ключу сортировки (по возрастанию).
+type imageLess func(a, b ImageData) bool
+
+// sortKeys перечисляет поддерживаемые значения параметра 'sort'.
+var sortKeys = map[string]imageLess{
+	"size":   func(a, b ImageData) bool { return a.Size < b.Size },
+	"width":  func(a, b ImageData) bool { return a.Width < b.Width },
+	"height": func(a, b ImageData) bool { return a.Height < b.Height },
+	"area":   func(a, b ImageData) bool { return a.Width*a.Height < b.Width*b.Height },
+	"name":   func(a, b ImageData) bool { return imageName(a.URL) < imageName(b.URL) },
+}
+
+// sortOrder — порядок вывода изображений, заданный в запросе.
+// Пустой Key означает порядок документа.
+type sortOrder struct {
+	Key  string
+	Desc bool
+}
+
+// parseSortOrder читает параметры 'sort' и направление сортировки из запроса.
+// Направление задаётся либо 'order=asc|desc', либо булевым 'desc'.
+func parseSortOrder(r *http.Request) (sortOrder, error) {
+	order := sortOrder{Key: r.FormValue("sort")}
+	if order.Key != "" {
+		if _, ok := sortKeys[order.Key]; !ok {
+			return sortOrder{}, fmt.Errorf("неизвестный ключ сортировки %q", order.Key)
+		}
+	}
+	if v := r.FormValue("desc"); v != "" {
+		desc, err := strconv.ParseBool(v)
+		if err != nil {
+			return sortOrder{}, fmt.Errorf("некорректное значение desc %q", v)
+		}
+		order.Desc = desc
+	}
+	switch v := r.FormValue("order"); v {
+	case "":
+	case "asc":
+		order.Desc = false
+	case "desc":
+		order.Desc = true
+	default:
+		return sortOrder{}, fmt.Errorf("некорректное значение order %q: ожидается asc или desc", v)
+	}
+	return order, nil
+}
+
+// apply сортирует изображения на месте. Без ключа порядок документа сохраняется.
+// При равенстве ключей изображения упорядочиваются по URL, чтобы вывод был стабильным.
+func (o sortOrder) apply(images []ImageData) {
+	less, ok := sortKeys[o.Key]
+	if !ok {
+		return
+	}
+	sort.Slice(images, func(i, j int) bool {
+		a, b := images[i], images[j]
+		switch {
+		case less(a, b):
+			return !o.Desc
+		case less(b, a):
+			return o.Desc
+		default:
+			return a.URL < b.URL
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSortOrderApply(t *testing.T) {
+	images := []ImageData{
+		{URL: "http://x/c.png", Width: 10, Height: 10, Size: 300},
+		{URL: "http://x/a.png", Width: 5, Height: 40, Size: 100},
+		{URL: "http://x/d.png", Width: 30, Height: 1, Size: 300},
+		{URL: "http://x/b.png", Width: 20, Height: 20, Size: 50},
+	}
+
+	tests := []struct {
+		order sortOrder
+		want  []string
+	}{
+		// Равные размеры (c и d) упорядочиваются по URL в обоих направлениях.
+		{sortOrder{Key: "size"}, []string{"b", "a", "c", "d"}},
+		{sortOrder{Key: "size", Desc: true}, []string{"c", "d", "a", "b"}},
+		// Площади: c=100, a=200, d=30, b=400 (равные площади — в TestSortOrderAreaTie).
+		{sortOrder{Key: "area"}, []string{"d", "c", "a", "b"}},
+		{sortOrder{Key: "area", Desc: true}, []string{"b", "a", "c", "d"}},
+		// Без ключа сохраняется порядок документа.
+		{sortOrder{}, []string{"c", "a", "d", "b"}},
+	}
+	for _, tt := range tests {
+		sorted := append([]ImageData(nil), images...)
+		tt.order.apply(sorted)
+		var got []string
+		for _, img := range sorted {
+			got = append(got, imageName(img.URL)[:1])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestSortOrderAreaTie(t *testing.T) {
+	// Одинаковая площадь 100 при разных сторонах.
+	images := []ImageData{
+		{URL: "http://x/z.png", Width: 10, Height: 10},
+		{URL: "http://x/y.png", Width: 50, Height: 2},
+		{URL: "http://x/x.png", Width: 1, Height: 1},
+	}
+	for _, desc := range []bool{false, true} {
+		sorted := append([]ImageData(nil), images...)
+		sortOrder{Key: "area", Desc: desc}.apply(sorted)
+		want := []string{"http://x/x.png", "http://x/y.png", "http://x/z.png"}
+		if desc {
+			want = []string{"http://x/y.png", "http://x/z.png", "http://x/x.png"}
+		}
+		if got := imageURLs(sorted); !reflect.DeepEqual(got, want) {
+			t.Errorf("desc=%v: got %v, want %v", desc, got, want)
+		}
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		query string
+		want  sortOrder
+		ok    bool
+	}{
+		{"", sortOrder{}, true},
+		{"sort=size", sortOrder{Key: "size"}, true},
+		{"sort=area&desc=1", sortOrder{Key: "area", Desc: true}, true},
+		{"sort=name&order=desc", sortOrder{Key: "name", Desc: true}, true},
+		{"sort=width&desc=true&order=asc", sortOrder{Key: "width"}, true},
+		{"sort=color", sortOrder{}, false},
+		{"sort=size&order=up", sortOrder{}, false},
+		{"sort=size&desc=maybe", sortOrder{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSortOrder(httptest.NewRequest("GET", "/api?"+tt.query, nil))
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %+v, %v; want %+v, ok=%v", tt.query, got, err, tt.want, tt.ok)
+		}
+	}
+}
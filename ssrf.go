@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// blockPrivate запрещает обращения к loopback, link-local и частным (RFC1918) адресам,
+// чтобы сервер нельзя было использовать как прокси во внутреннюю сеть.
+// Отключается флагом -block-private=false для тех, кто сканирует страницы в интранете.
+var blockPrivate = true
+
+// httpClient используется для всех исходящих запросов. Адрес проверяется при каждом
+// подключении, уже после разрешения имени (см. checkDialAddr), поэтому хост, который
+// при повторном разрешении вернёт внутренний адрес (DNS rebinding), тоже будет отклонён.
+// Каждый редирект проходит ту же проверку схемы и хоста, что и исходный URL.
+var httpClient = &http.Client{
+	Timeout:   30 * time.Second,
+	Transport: newTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("слишком много редиректов")
+		}
+		return validateURL(req.URL.String())
+	},
+}
+
+// newTransport создаёт транспорт на основе стандартного, который проверяет адрес при подключении.
+// Прокси из окружения не используется: через прокси подключение шло бы к его адресу,
+// и проверка целевого адреса не сработала бы.
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDialAddr,
+	}
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// checkDialAddr вызывается перед каждым подключением с уже разрешённым адресом ("ip:port")
+// и отклоняет внутренние адреса, если включён blockPrivate.
+func checkDialAddr(network, address string, _ syscall.RawConn) error {
+	if !blockPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("некорректный адрес подключения %s", address)
+	}
+	if isInternalIP(ip) {
+		return fmt.Errorf("запрещено обращение к внутреннему адресу %s", ip)
+	}
+	return nil
+}
+
+// validateURL проверяет, что URL использует схему http(s) и содержит хост.
+// Сам адрес хоста проверяется при подключении (см. checkDialAddr).
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("некорректный URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("схема %q не поддерживается: %s", u.Scheme, rawURL)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("в URL не указан хост: %s", rawURL)
+	}
+	return nil
+}
+
+// isInternalIP сообщает, относится ли адрес к loopback, link-local или частным диапазонам.
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"http://example.com/a.png", true},
+		{"https://example.com:8443/", true},
+		{"ftp://example.com/a.png", false},
+		{"file:///etc/passwd", false},
+		{"javascript:alert(1)", false},
+		{"http:///a.png", false},
+	}
+	for _, tt := range tests {
+		if err := validateURL(tt.url); (err == nil) != tt.ok {
+			t.Errorf("validateURL(%q) = %v, want ok=%v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestIsInternalIP(t *testing.T) {
+	tests := []struct {
+		ip       string
+		internal bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"93.184.216.34", false},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := isInternalIP(net.ParseIP(tt.ip)); got != tt.internal {
+			t.Errorf("isInternalIP(%s) = %v, want %v", tt.ip, got, tt.internal)
+		}
+	}
+}
+
+func TestBlockPrivateAtConnect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	// Имя localhost проходит проверку URL, но разрешается во внутренний адрес,
+	// поэтому подключение к нему должно быть отклонено так же, как к IP-адресу.
+	byName := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	setVar(t, &blockPrivate, true)
+	for _, target := range []string{srv.URL, byName} {
+		resp, err := doGet(target, nil)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("blockPrivate=true: request to %s succeeded", target)
+		} else if !strings.Contains(err.Error(), "внутреннему адресу") {
+			t.Errorf("blockPrivate=true: unexpected error for %s: %v", target, err)
+		}
+	}
+
+	blockPrivate = false
+	for _, target := range []string{srv.URL, byName} {
+		resp, err := doGet(target, nil)
+		if err != nil {
+			t.Errorf("blockPrivate=false: request to %s failed: %v", target, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestBlockPrivateRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/a.png", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// Редирект на неподдерживаемую схему отклоняется.
+	if resp, err := doGet(srv.URL, nil); err == nil {
+		resp.Body.Close()
+		t.Error("redirect to ftp:// was followed")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// db хранит историю сканирований. Открывается при запуске, если задан флаг -db.
+var db *sql.DB
+
+// openDB открывает (или создаёт) базу SQLite и подготавливает таблицу изображений.
+func openDB(path string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS images (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		url        TEXT    NOT NULL,
+		width      INTEGER NOT NULL,
+		height     INTEGER NOT NULL,
+		size       INTEGER NOT NULL,
+		scraped_at TIMESTAMP NOT NULL,
+		page_url   TEXT    NOT NULL
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// saveImages записывает результаты одного сканирования страницы в базу.
+// Все строки одного сканирования получают одинаковое время scraped_at.
+func saveImages(conn *sql.DB, pageURL string, images []ImageData) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO images (url, width, height, size, scraped_at, page_url) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	scrapedAt := time.Now().UTC()
+	for _, img := range images {
+		if _, err := stmt.Exec(img.URL, img.Width, img.Height, img.Size, scrapedAt, pageURL); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
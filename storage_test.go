@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveImagesToSQLite(t *testing.T) {
+	conn, err := openDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	setVar(t, &db, conn)
+
+	site := newSite(t, map[string]string{"/": `<html><body><img src="/a.png"><img src="/b.png"></body></html>`})
+	pageURL := site.URL + "/"
+	before := time.Now().UTC().Add(-time.Second)
+	result, err := fetchImages(pageURL, scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := conn.Query(`SELECT url, width, height, size, scraped_at, page_url FROM images ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []ImageData
+	for rows.Next() {
+		var img ImageData
+		var scrapedAt time.Time
+		var page string
+		if err := rows.Scan(&img.URL, &img.Width, &img.Height, &img.Size, &scrapedAt, &page); err != nil {
+			t.Fatal(err)
+		}
+		if page != pageURL {
+			t.Errorf("page_url = %q, want %q", page, pageURL)
+		}
+		if scrapedAt.Before(before) || scrapedAt.After(time.Now().UTC()) {
+			t.Errorf("scraped_at = %v is outside the scrape window", scrapedAt)
+		}
+		got = append(got, img)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(result.Images) {
+		t.Fatalf("got %d rows, want %d", len(got), len(result.Images))
+	}
+	for i, img := range result.Images {
+		want := ImageData{URL: img.URL, Width: img.Width, Height: img.Height, Size: img.Size}
+		if got[i] != want {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want)
+		}
+	}
+}
+
+func TestRepeatedScrapeRecordedDespiteCache(t *testing.T) {
+	conn, err := openDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	setVar(t, &db, conn)
+	setVar(t, &cacheTTL, 5*time.Minute)
+
+	site := newSite(t, map[string]string{"/": `<html><body><img src="/a.png"><img src="/b.png"></body></html>`})
+	for i := 0; i < 2; i++ {
+		if _, err := fetchImages(site.URL+"/", scrapeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rows int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM images`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 4 {
+		t.Errorf("got %d rows after two scrapes of two images, want 4", rows)
+	}
+	var scrapes int
+	if err := conn.QueryRow(`SELECT COUNT(DISTINCT scraped_at) FROM images`).Scan(&scrapes); err != nil {
+		t.Fatal(err)
+	}
+	if scrapes != 2 {
+		t.Errorf("got %d distinct scraped_at values, want 2", scrapes)
+	}
+}
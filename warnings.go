@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Коды предупреждений об аномалиях, найденных при разборе страницы.
+const (
+	warnSrcsetWithoutSrc   = "srcset_without_src"
+	warnDataSrcPlaceholder = "data_src_placeholder"
+)
+
+// Warning — предупреждение об аномалии при извлечении изображений: не ошибка загрузки,
+// а признак того, что часть изображений могла быть пропущена.
+type Warning struct {
+	Page    string `json:"page"`    // Страница, на которой найдена аномалия
+	Code    string `json:"code"`    // Машиночитаемый код (см. константы warn*)
+	Message string `json:"message"` // Описание для человека
+}
+
+// imgWarnings проверяет атрибуты элемента <img> на признаки того, что настоящее изображение
+// подставляется скриптом: srcset без src или атрибут data-src ленивой загрузки.
+func imgWarnings(node *html.Node, pageURL string) []Warning {
+	var src, srcset, dataSrc string
+	var hasSrc bool
+	for _, attr := range node.Attr {
+		switch attr.Key {
+		case "src":
+			src, hasSrc = attr.Val, true
+		case "srcset":
+			srcset = attr.Val
+		case "data-src":
+			dataSrc = attr.Val
+		}
+	}
+
+	var warnings []Warning
+	if strings.TrimSpace(srcset) != "" && (!hasSrc || strings.TrimSpace(src) == "") {
+		warnings = append(warnings, Warning{
+			Page:    pageURL,
+			Code:    warnSrcsetWithoutSrc,
+			Message: fmt.Sprintf("у <img> есть srcset, но нет src: %s", srcset),
+		})
+	}
+	if strings.TrimSpace(dataSrc) != "" {
+		warnings = append(warnings, Warning{
+			Page:    pageURL,
+			Code:    warnDataSrcPlaceholder,
+			Message: fmt.Sprintf("обнаружен data-src (ленивая загрузка), src=%q, data-src=%q", src, dataSrc),
+		})
+	}
+	return warnings
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestImgWarnings(t *testing.T) {
+	const doc = `<html><body>
+<img srcset="/a-1x.png 1x, /a-2x.png 2x">
+<img src="" srcset="/b.png 1x">
+<img src="/c.png" srcset="/c-2x.png 2x">
+<img src="/placeholder.gif" data-src="/real.jpg">
+</body></html>`
+
+	n, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, warnings, err := extractImageURLs(n, "http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var codes []string
+	for _, w := range warnings {
+		if w.Page != "http://example.com/" {
+			t.Errorf("warning %q has page %q", w.Code, w.Page)
+		}
+		codes = append(codes, w.Code)
+	}
+	want := []string{warnSrcsetWithoutSrc, warnSrcsetWithoutSrc, warnDataSrcPlaceholder}
+	if strings.Join(codes, ",") != strings.Join(want, ",") {
+		t.Errorf("warning codes = %v, want %v", codes, want)
+	}
+}
+
+func TestWarningsInAPIOutput(t *testing.T) {
+	site := newSite(t, map[string]string{"/": `<html><body><img srcset="/a.png 1x"><img src="/b.png"></body></html>`})
+
+	rec := httptest.NewRecorder()
+	APIHandler(rec, httptest.NewRequest("GET", "/api?url="+url.QueryEscape(site.URL+"/"), nil))
+	var result ScrapeResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Code != warnSrcsetWithoutSrc {
+		t.Errorf("warnings = %+v, want one %s", result.Warnings, warnSrcsetWithoutSrc)
+	}
+}